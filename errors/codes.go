@@ -0,0 +1,149 @@
+package errors
+
+import (
+	stderrors "errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CodeNamor/Common/logging"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// Code classifies an error consistently across services, see
+// RegisterCode for what a code implies
+type Code string
+
+// Codes registered by this package
+const (
+	CodeInvalidArgument  Code = "InvalidArgument"
+	CodeUnauthenticated  Code = "Unauthenticated"
+	CodePermissionDenied Code = "PermissionDenied"
+	CodeNotFound         Code = "NotFound"
+	CodeConflict         Code = "Conflict"
+	CodeRateLimited      Code = "RateLimited"
+	CodeInternal         Code = "Internal"
+	CodeUnavailable      Code = "Unavailable"
+	CodeTimeout          Code = "Timeout"
+)
+
+// CodeInfo is what a registered Code implies
+type CodeInfo struct {
+	HTTPStatus  int           // default HTTP status of the error
+	Retryable   bool          // the operation may succeed if retried
+	Severity    logging.Level // level the error is logged at
+	UserMessage string        // safe to show to end users
+}
+
+var codes = struct {
+	mu    sync.RWMutex
+	infos map[Code]CodeInfo
+}{
+	infos: map[Code]CodeInfo{
+		CodeInvalidArgument:  {HTTPStatus: http.StatusBadRequest, Severity: logging.WarningLevel, UserMessage: "The request is invalid."},
+		CodeUnauthenticated:  {HTTPStatus: http.StatusUnauthorized, Severity: logging.WarningLevel, UserMessage: "Authentication is required."},
+		CodePermissionDenied: {HTTPStatus: http.StatusForbidden, Severity: logging.WarningLevel, UserMessage: "You do not have permission to do this."},
+		CodeNotFound:         {HTTPStatus: http.StatusNotFound, Severity: logging.InfoLevel, UserMessage: "The resource was not found."},
+		CodeConflict:         {HTTPStatus: http.StatusConflict, Severity: logging.WarningLevel, UserMessage: "The request conflicts with the current state."},
+		CodeRateLimited:      {HTTPStatus: http.StatusTooManyRequests, Retryable: true, Severity: logging.WarningLevel, UserMessage: "Too many requests, try again later."},
+		CodeInternal:         {HTTPStatus: http.StatusInternalServerError, Severity: logging.ErrorLevel, UserMessage: "An internal error occurred."},
+		CodeUnavailable:      {HTTPStatus: http.StatusServiceUnavailable, Retryable: true, Severity: logging.ErrorLevel, UserMessage: "The service is unavailable, try again later."},
+		CodeTimeout:          {HTTPStatus: http.StatusGatewayTimeout, Retryable: true, Severity: logging.ErrorLevel, UserMessage: "The request timed out, try again later."},
+	},
+}
+
+// RegisterCode adds code to the registry, or replaces what a
+// registered code implies
+func RegisterCode(code Code, info CodeInfo) {
+	codes.mu.Lock()
+	defer codes.mu.Unlock()
+	codes.infos[code] = info
+}
+
+// unregisterCode removes code from the registry
+func unregisterCode(code Code) {
+	codes.mu.Lock()
+	defer codes.mu.Unlock()
+	delete(codes.infos, code)
+}
+
+// Info returns what code implies and whether it is registered
+func (code Code) Info() (CodeInfo, bool) {
+	codes.mu.RLock()
+	defer codes.mu.RUnlock()
+	info, ok := codes.infos[code]
+	return info, ok
+}
+
+// String returns the code as a string
+func (code Code) String() string {
+	return string(code)
+}
+
+// NewCode creates an ErrorLog structure with the Code and the Err
+// created by pkg/errors from the format and args, which contains
+// the current stack
+func NewCode(code Code, format string, args ...interface{}) *ErrorLog {
+	return &ErrorLog{
+		Code: code,
+		Err:  pkgerrors.Errorf(format, args...),
+	}
+}
+
+// CodeOf returns the first Code set on an ErrorLog in the chain of
+// err, or "" if there is none
+func CodeOf(err error) Code {
+	for err != nil {
+		var errorLog ErrorLog
+		if !asErrorLog(err, &errorLog) {
+			return ""
+		}
+		if errorLog.Code != "" {
+			return errorLog.Code
+		}
+		err = errorLog.Err
+	}
+	return ""
+}
+
+// IsRetryable reports whether the operation that failed with err may
+// succeed if retried, either because of the registered Code of err
+// or because an error in the chain has a Temporary() method
+// returning true, as net errors do
+func IsRetryable(err error) bool {
+	if code := CodeOf(err); code != "" {
+		if info, ok := code.Info(); ok {
+			return info.Retryable
+		}
+	}
+	var temporary interface{ Temporary() bool }
+	return stderrors.As(err, &temporary) && temporary.Temporary()
+}
+
+// HTTPStatus returns the HTTP status for err: the StatusCode of the
+// first ErrorLog in the chain if it is a valid 4xx or 5xx code,
+// otherwise the status of the registered Code, otherwise 500
+func HTTPStatus(err error) int {
+	var errorLog ErrorLog
+	if asErrorLog(err, &errorLog) {
+		if status, convErr := strconv.Atoi(strings.TrimSpace(errorLog.StatusCode)); convErr == nil && status >= 400 && status <= 599 {
+			return status
+		}
+	}
+	if info, ok := CodeOf(err).Info(); ok && info.HTTPStatus != 0 {
+		return info.HTTPStatus
+	}
+	return http.StatusInternalServerError
+}
+
+// asErrorLog sets target to the first ErrorLog in the chain of err,
+// whether it is a pointer or a value
+func asErrorLog(err error, target *ErrorLog) bool {
+	var errorLog *ErrorLog
+	if stderrors.As(err, &errorLog) && errorLog != nil {
+		*target = *errorLog
+		return true
+	}
+	return stderrors.As(err, target)
+}
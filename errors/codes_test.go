@@ -0,0 +1,97 @@
+package errors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/CodeNamor/Common/logging"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewCode(t *testing.T) {
+	errorLog := NewCode(CodeNotFound, "widget %d not found", 9)
+	require.Equal(t, CodeNotFound, errorLog.Code)
+	require.Equal(t, "widget 9 not found", errorLog.Err.Error())
+	require.Equal(t, "widget 9 not found Code:NotFound", errorLog.Error())
+
+	bytes, err := json.Marshal(errorLog)
+	require.NoError(t, err)
+	require.Equal(t, `{"Trace":"widget 9 not found","Code":"NotFound"}`, string(bytes))
+}
+
+func Test_RegisterCode(t *testing.T) {
+	t.Cleanup(func() { unregisterCode("QuotaExceeded") })
+	_, ok := Code("QuotaExceeded").Info()
+	require.False(t, ok)
+
+	info := CodeInfo{HTTPStatus: 429, Retryable: true, Severity: logging.WarningLevel, UserMessage: "Quota exceeded."}
+	RegisterCode("QuotaExceeded", info)
+	registered, ok := Code("QuotaExceeded").Info()
+	require.True(t, ok)
+	require.Equal(t, info, registered)
+}
+
+func Test_CodeOf(t *testing.T) {
+	testcases := []struct {
+		name     string
+		err      error
+		expected Code
+	}{
+		{name: "nil", err: nil, expected: ""},
+		{name: "plain error", err: pkgerrors.New("boom"), expected: ""},
+		{name: "ErrorLog without code", err: New("boom"), expected: ""},
+		{name: "ErrorLog", err: NewCode(CodeConflict, "version"), expected: CodeConflict},
+		{name: "wrapped", err: fmt.Errorf("saving: %w", NewCode(CodeConflict, "version")), expected: CodeConflict},
+		{name: "ErrorLog wrapping ErrorLog", err: WithErrorAndCause(NewCode(CodeTimeout, "slow"), "calling"), expected: CodeTimeout},
+		{name: "value", err: pkgerrors.WithMessage(ErrorLog{Code: CodeInternal}, "calling"), expected: CodeInternal},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, CodeOf(tc.err))
+		})
+	}
+}
+
+func Test_IsRetryable(t *testing.T) {
+	testcases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "nil", err: nil, expected: false},
+		{name: "retryable code", err: fmt.Errorf("loading: %w", NewCode(CodeUnavailable, "down")), expected: true},
+		{name: "permanent code", err: NewCode(CodeInvalidArgument, "bad"), expected: false},
+		{name: "unregistered code", err: NewCode("Unregistered", "odd"), expected: false},
+		{name: "temporary error", err: WithErrorAndCause(&net.DNSError{Err: "timeout", IsTemporary: true}, "lookup"), expected: true},
+		{name: "plain error", err: context.Canceled, expected: false},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, IsRetryable(tc.err))
+		})
+	}
+}
+
+func Test_HTTPStatus(t *testing.T) {
+	testcases := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "code", err: NewCode(CodePermissionDenied, "no"), expected: 403},
+		{name: "wrapped code", err: fmt.Errorf("handler: %w", NewCode(CodeRateLimited, "slow down")), expected: 429},
+		{name: "StatusCode overrides code", err: &ErrorLog{StatusCode: "410", Code: CodeNotFound}, expected: 410},
+		{name: "invalid StatusCode", err: &ErrorLog{StatusCode: "OK", Code: CodeNotFound}, expected: 404},
+		{name: "StatusCode", err: NewRootMsgStatusCode("bad", "input", "400"), expected: 400},
+		{name: "plain error", err: pkgerrors.New("boom"), expected: 500},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, HTTPStatus(tc.err))
+		})
+	}
+}
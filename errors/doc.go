@@ -23,12 +23,54 @@ There are a variety of helper factory functions to create *ErrorLog structs.
 
 # Interfaces implemented
 
-ErrorLog implements the error, formatter, and stringer interfaces. It also provides a custom JSON marshaller which merges the Trace and Err fields in the JSON output.
+ErrorLog implements the error, formatter, and stringer interfaces. It also provides a custom JSON marshaller which merges the Trace and Err fields in the JSON output, and a matching unmarshaller which keeps the merged value in Trace.
 
 	fmt.Println(errorLog) // stringer interface allows errorLog.Error() be coerced to a string
 	errorLog.Error()  // error interface outputs the fields as an error string
 	fmt.Printf("%v", errorLog)  // formats the errorLog.Error()
 	fmt.Printf("%+v", errorLog) // provides extended detailed output including callstack if err contains it
 	bytes, err := json.Marshal(errorLog)   // custom marshalled JSON with Trace and Err merged
+
+# Codes
+
+A Code classifies an error consistently across services. Each registered code has a default
+HTTP status, whether the operation is retryable, the log severity and a message safe to show
+to end users. CodeOf, IsRetryable and HTTPStatus work through wrapped errors.
+
+	RegisterCode("QuotaExceeded", CodeInfo{HTTPStatus: 429, Severity: logging.WarningLevel})
+	errorLog := NewCode(CodeUnavailable, "inventory service down after %d attempts", 3)
+	IsRetryable(fmt.Errorf("loading: %w", errorLog)) // true
+	HTTPStatus(errorLog)                              // 503
+
+# Lists
+
+A List collects the errors of operations run in parallel, such as fan out calls to backends.
+Add every result, nil for successes, then use PartialFailure or TotalFailure to decide what
+to return. A List unwraps to its errors and marshals to a JSON array of ErrorLog.
+
+	list := &List{}
+	for _, backend := range backends {
+		wg.Add(1)
+		go func(backend Backend) {
+			defer wg.Done()
+			list.Add(backend.Call(ctx))
+		}(backend)
+	}
+	wg.Wait()
+	logging.WithField(logfields.ErrorsCount, list.Len()).Info("fan out complete")
+	if list.TotalFailure() {
+		return list.Err()
+	}
+
+# Wrapping
+
+ErrorLog unwraps to its Err so errors.Is and errors.As find the cause it wraps. An ErrorLog
+with only a StatusCode and/or ExceptionType can be used as a sentinel matched by code. The
+Is, As and Join helpers save importing the standard library errors package too.
+
+	var ErrNotFound = &ErrorLog{StatusCode: "404"}
+	Is(NewRootMsgStatusCode("no widget", "missing", "404"), ErrNotFound) // true
+	Is(WithErrorAndCause(context.DeadlineExceeded, "slow"), context.DeadlineExceeded) // true
+	errorLog := FromError(fmt.Errorf("loading: %w", New("myerror"))) // the wrapped *ErrorLog
 */
 package errors
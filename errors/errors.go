@@ -2,6 +2,7 @@ package errors
 
 import (
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"io"
 	"strings"
@@ -23,6 +24,7 @@ type ErrorLog struct {
 	Query                 string `json:"Query,omitempty"`
 	AdditionalInformation string `json:"AdditionalInformation,omitempty"`
 	ExceptionType         string `json:"ExceptionType,omitempty"`
+	Code                  Code   `json:"Code,omitempty"`
 	Err                   error  `json:"-"`
 }
 
@@ -53,15 +55,21 @@ func Errorf(format string, args ...interface{}) *ErrorLog {
 
 // FromError creates an ErrorLog structure populating the Err
 // field. If nil is passed as the err then a nil *ErrorLog is
-// returned
+// returned. If err is or wraps an ErrorLog then that ErrorLog
+// is returned.
 func FromError(err error) *ErrorLog {
 	if err == nil {
 		return nil
 	}
-	// if it already is a ErrorLog simply return itself
-	if errorLog, ok := err.(*ErrorLog); ok {
+	// if it already is or wraps an ErrorLog simply return it
+	var errorLog *ErrorLog
+	if stderrors.As(err, &errorLog) && errorLog != nil {
 		return errorLog
 	}
+	var errorLogValue ErrorLog
+	if stderrors.As(err, &errorLogValue) {
+		return &errorLogValue
+	}
 	return &ErrorLog{
 		Err: err,
 	}
@@ -94,6 +102,59 @@ func (el ErrorLog) Error() string {
 	return errorLogToErrorString(true, &el)
 }
 
+// Unwrap returns Err so errors.Is and errors.As can
+// find the underlying cause
+func (el ErrorLog) Unwrap() error {
+	return el.Err
+}
+
+// Is reports whether target is an ErrorLog with the same code,
+// which allows sentinels such as
+//
+//	var ErrNotFound = &ErrorLog{StatusCode: "404"}
+//	errors.Is(err, ErrNotFound)
+//
+// The StatusCode, ExceptionType and Code set on target must
+// match, a target with none of them set matches nothing.
+func (el ErrorLog) Is(target error) bool {
+	var code ErrorLog
+	switch t := target.(type) {
+	case *ErrorLog:
+		if t == nil {
+			return false
+		}
+		code = *t
+	case ErrorLog:
+		code = t
+	default:
+		return false
+	}
+	if code.StatusCode == "" && code.ExceptionType == "" && code.Code == "" {
+		return false
+	}
+	return (code.StatusCode == "" || code.StatusCode == el.StatusCode) &&
+		(code.ExceptionType == "" || code.ExceptionType == el.ExceptionType) &&
+		(code.Code == "" || code.Code == el.Code)
+}
+
+// Is reports whether any error in the chain of err matches target,
+// see the standard library errors.Is
+func Is(err error, target error) bool {
+	return stderrors.Is(err, target)
+}
+
+// As finds the first error in the chain of err that matches target
+// and sets target to it, see the standard library errors.As
+func As(err error, target interface{}) bool {
+	return stderrors.As(err, target)
+}
+
+// Join returns an error wrapping errs, nil errs are discarded and nil
+// is returned if all are nil, see the standard library errors.Join
+func Join(errs ...error) error {
+	return stderrors.Join(errs...)
+}
+
 // errorLogToErrorString is the implementation that converts
 // data from ErrorLog to an error string. includeErr determines
 // wheter the errorLog.err msg is included in the string, since
@@ -112,6 +173,9 @@ func errorLogToErrorString(includeErr bool, el *ErrorLog) string {
 	if el.StatusCode != "" {
 		segments = append(segments, "StatusCode:"+el.StatusCode)
 	}
+	if el.Code != "" {
+		segments = append(segments, "Code:"+string(el.Code))
+	}
 	if el.Source != "" {
 		segments = append(segments, "Source:"+el.Source)
 	}
@@ -176,6 +240,21 @@ func (el ErrorLog) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// UnmarshalJSON implements custom unmarshalling for ErrorLog
+// which is symmetric with MarshalJSON. The merged Trace and Err
+// are kept in Trace and Err is left nil, so marshalling the
+// result produces the same JSON.
+func (el *ErrorLog) UnmarshalJSON(data []byte) error {
+	type Alias ErrorLog
+	alias := Alias{}
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return err
+	}
+	*el = ErrorLog(alias)
+	el.Err = nil
+	return nil
+}
+
 // combineStringAndError combines the string and
 // error string values inserting a space separator
 // if needed
@@ -1,6 +1,7 @@
 package errors
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	pkgerrors "github.com/pkg/errors"
@@ -112,6 +113,7 @@ func Test_Errorf(t *testing.T) {
 }
 func Test_FromError(t *testing.T) {
 	err1 := pkgerrors.New("myerror1")
+	errorLog1 := NewRootMsgStatusCode("myroot", "myerror1", "400")
 	testcases := []struct {
 		name     string
 		err      error
@@ -129,6 +131,21 @@ func Test_FromError(t *testing.T) {
 				Err: err1,
 			},
 		},
+		{
+			name:     "ErrorLog",
+			err:      errorLog1,
+			expected: errorLog1,
+		},
+		{
+			name:     "wrapped ErrorLog",
+			err:      fmt.Errorf("loading: %w", errorLog1),
+			expected: errorLog1,
+		},
+		{
+			name:     "wrapped ErrorLog value",
+			err:      pkgerrors.WithMessage(*errorLog1, "loading"),
+			expected: errorLog1,
+		},
 	}
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -137,6 +154,62 @@ func Test_FromError(t *testing.T) {
 	}
 }
 
+func Test_Unwrap(t *testing.T) {
+	errorLog := WithErrorAndCause(fmt.Errorf("calling: %w", context.DeadlineExceeded), "slow upstream")
+	require.True(t, Is(errorLog, context.DeadlineExceeded))
+	require.True(t, Is(fmt.Errorf("handler: %w", errorLog), context.DeadlineExceeded))
+	require.False(t, Is(errorLog, context.Canceled))
+
+	var pathErr *customError
+	require.True(t, As(WithErrorAndCause(&customError{"disk"}, "saving"), &pathErr))
+	require.Equal(t, "disk", pathErr.msg)
+	require.Nil(t, ErrorLog{}.Unwrap())
+}
+
+type customError struct {
+	msg string
+}
+
+func (e *customError) Error() string { return e.msg }
+
+func Test_Is(t *testing.T) {
+	notFound := NewRootMsgStatusCode("no widget", "missing", "404")
+	notFound.ExceptionType = "WidgetMissing"
+	testcases := []struct {
+		name     string
+		err      error
+		target   error
+		expected bool
+	}{
+		{name: "status code", err: notFound, target: &ErrorLog{StatusCode: "404"}, expected: true},
+		{name: "exception type", err: notFound, target: &ErrorLog{ExceptionType: "WidgetMissing"}, expected: true},
+		{name: "both", err: notFound, target: &ErrorLog{StatusCode: "404", ExceptionType: "WidgetMissing"}, expected: true},
+		{name: "value target", err: notFound, target: ErrorLog{StatusCode: "404"}, expected: true},
+		{name: "wrapped", err: fmt.Errorf("handler: %w", notFound), target: &ErrorLog{StatusCode: "404"}, expected: true},
+		{name: "different status code", err: notFound, target: &ErrorLog{StatusCode: "500"}, expected: false},
+		{name: "different exception type", err: notFound, target: &ErrorLog{StatusCode: "404", ExceptionType: "Gone"}, expected: false},
+		{name: "code", err: NewCode(CodeNotFound, "missing"), target: &ErrorLog{Code: CodeNotFound}, expected: true},
+		{name: "different code", err: NewCode(CodeNotFound, "missing"), target: &ErrorLog{Code: CodeConflict}, expected: false},
+		{name: "no code", err: notFound, target: &ErrorLog{RootCause: "no widget"}, expected: false},
+		{name: "nil target", err: notFound, target: (*ErrorLog)(nil), expected: false},
+		{name: "other target", err: notFound, target: pkgerrors.New("missing"), expected: false},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, Is(tc.err, tc.target))
+		})
+	}
+}
+
+func Test_Join(t *testing.T) {
+	errorLog := NewRootMsgStatusCode("bad input", "name is required", "400")
+	joined := Join(nil, errorLog, context.Canceled)
+	require.True(t, Is(joined, context.Canceled))
+	require.True(t, Is(joined, &ErrorLog{StatusCode: "400"}))
+	require.Equal(t, errorLog, FromError(joined))
+	require.Nil(t, Join(nil, nil))
+}
+
 func Test_WithErrorAndCause(t *testing.T) {
 	err1 := pkgerrors.New("myerror1")
 	testcases := []struct {
@@ -450,6 +523,74 @@ func Test_JSONMarshal(t *testing.T) {
 	}
 }
 
+func Test_JSONUnmarshal(t *testing.T) {
+	testcases := []struct {
+		name     string
+		errorLog ErrorLog
+		expected ErrorLog
+	}{
+		{
+			name:     "only err",
+			errorLog: ErrorLog{Err: fmt.Errorf("myerror")},
+			expected: ErrorLog{Trace: "myerror"},
+		},
+		{
+			name:     "trace, err",
+			errorLog: ErrorLog{Trace: "mytrace", Err: fmt.Errorf("myerror")},
+			expected: ErrorLog{Trace: "mytrace myerror"},
+		},
+		{
+			name: "all fields",
+			errorLog: ErrorLog{
+				RootCause:             "myroot",
+				Trace:                 "mytrace",
+				StatusCode:            "503",
+				Source:                "inventory",
+				Scope:                 "GeneralInfo",
+				Query:                 "/widgets",
+				AdditionalInformation: "myinfo",
+				ExceptionType:         "myexc",
+				Code:                  CodeUnavailable,
+			},
+			expected: ErrorLog{
+				RootCause:             "myroot",
+				Trace:                 "mytrace",
+				StatusCode:            "503",
+				Source:                "inventory",
+				Scope:                 "GeneralInfo",
+				Query:                 "/widgets",
+				AdditionalInformation: "myinfo",
+				ExceptionType:         "myexc",
+				Code:                  CodeUnavailable,
+			},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			bytes, err := json.Marshal(tc.errorLog)
+			require.NoError(t, err)
+			decoded := ErrorLog{}
+			require.NoError(t, json.Unmarshal(bytes, &decoded))
+			require.Equal(t, tc.expected, decoded)
+
+			// marshalling the decoded ErrorLog produces the same JSON
+			roundTripped, err := json.Marshal(decoded)
+			require.NoError(t, err)
+			require.Equal(t, string(bytes), string(roundTripped))
+		})
+	}
+
+	t.Run("unknown fields", func(t *testing.T) {
+		decoded := ErrorLog{Err: fmt.Errorf("previous")}
+		require.NoError(t, json.Unmarshal([]byte(`{"RootCause":"myroot","RequestId":"rid-1"}`), &decoded))
+		require.Equal(t, ErrorLog{RootCause: "myroot"}, decoded)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		require.Error(t, json.Unmarshal([]byte(`["myroot"]`), &ErrorLog{}))
+	})
+}
+
 func Test_combineStringAndError(t *testing.T) {
 	testcases := []struct {
 		name     string
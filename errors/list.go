@@ -0,0 +1,144 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// List collects the errors of several operations, such as parallel
+// calls to backends, and is safe for concurrent use. Add the result
+// of every operation, including nil for successes, so PartialFailure
+// and TotalFailure can tell them apart. The zero value is ready to use.
+type List struct {
+	mu       sync.Mutex
+	errs     []*ErrorLog
+	attempts int
+}
+
+// Add records the result of an operation, a nil err, including a
+// nil *ErrorLog such as WithErrorAndCause returns for a nil error, is
+// a success. An *ErrorLog is added as is, other errors are wrapped in
+// an ErrorLog without unwrapping them, so context such as which
+// backend failed is kept.
+func (l *List) Add(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.attempts++
+	if err == nil {
+		return
+	}
+	errorLog, ok := err.(*ErrorLog)
+	if !ok {
+		errorLog = &ErrorLog{Err: err}
+	}
+	if errorLog == nil {
+		return
+	}
+	l.errs = append(l.errs, errorLog)
+}
+
+// Errors returns a copy of the errors added so far
+func (l *List) Errors() []*ErrorLog {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*ErrorLog(nil), l.errs...)
+}
+
+// Len returns the number of errors
+func (l *List) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.errs)
+}
+
+// Attempts returns the number of results added, successes included
+func (l *List) Attempts() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.attempts
+}
+
+// PartialFailure reports whether some operations failed and some
+// succeeded
+func (l *List) PartialFailure() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.errs) > 0 && len(l.errs) < l.attempts
+}
+
+// TotalFailure reports whether every operation failed
+func (l *List) TotalFailure() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.errs) > 0 && len(l.errs) == l.attempts
+}
+
+// Err returns the List as an error, or nil if there are no errors,
+// so it can be returned without a typed nil
+func (l *List) Err() error {
+	if l.Len() == 0 {
+		return nil
+	}
+	return l
+}
+
+// Error implements the error interface, joining the errors with "; "
+func (l *List) Error() string {
+	errs := l.Errors()
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	messages := make([]string, 0, len(errs))
+	for _, errorLog := range errs {
+		messages = append(messages, errorLog.Error())
+	}
+	return strconv.Itoa(len(errs)) + " errors: " + strings.Join(messages, "; ")
+}
+
+// Unwrap returns the errors so errors.Is and errors.As check each of
+// them
+func (l *List) Unwrap() []error {
+	errs := l.Errors()
+	unwrapped := make([]error, 0, len(errs))
+	for _, errorLog := range errs {
+		unwrapped = append(unwrapped, errorLog)
+	}
+	return unwrapped
+}
+
+// Format implements the Formatter interface so a List can be formatted.
+// %v and %s outputs list.Error()
+// %q outputs a quoted list.Error()
+// %+v outputs each error formatted with %+v on its own line
+func (l *List) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			errs := l.Errors()
+			io.WriteString(s, strconv.Itoa(len(errs))+" errors:")
+			for _, errorLog := range errs {
+				fmt.Fprintf(s, "\n%+v", errorLog)
+			}
+			return
+		}
+		fallthrough
+	case 's':
+		io.WriteString(s, l.Error())
+	case 'q':
+		fmt.Fprintf(s, "%q", l.Error())
+	}
+}
+
+// MarshalJSON implements marshalling a List as a JSON array
+// of ErrorLog
+func (l *List) MarshalJSON() ([]byte, error) {
+	errs := l.Errors()
+	if errs == nil {
+		errs = []*ErrorLog{}
+	}
+	return json.Marshal(errs)
+}
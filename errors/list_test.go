@@ -0,0 +1,138 @@
+package errors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_List_Concurrent(t *testing.T) {
+	list := &List{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%5 == 0 {
+				list.Add(NewRootMsgStatusCode("backend failed", fmt.Sprintf("backend %d", i), "502"))
+				return
+			}
+			list.Add(nil)
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, 10, list.Len())
+	require.Equal(t, 50, list.Attempts())
+	require.True(t, list.PartialFailure())
+	require.False(t, list.TotalFailure())
+}
+
+func Test_List_Outcomes(t *testing.T) {
+	testcases := []struct {
+		name        string
+		results     []error
+		wantErr     bool
+		wantPartial bool
+		wantTotal   bool
+	}{
+		{name: "no results"},
+		{name: "all succeeded", results: []error{nil, nil}},
+		{name: "partial", results: []error{nil, pkgerrors.New("boom")}, wantErr: true, wantPartial: true},
+		{name: "total", results: []error{pkgerrors.New("boom"), pkgerrors.New("bang")}, wantErr: true, wantTotal: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			list := &List{}
+			for _, err := range tc.results {
+				list.Add(err)
+			}
+			require.Equal(t, tc.wantErr, list.Err() != nil)
+			require.Equal(t, tc.wantPartial, list.PartialFailure())
+			require.Equal(t, tc.wantTotal, list.TotalFailure())
+		})
+	}
+}
+
+func Test_List_Error(t *testing.T) {
+	list := &List{}
+	list.Add(NewRootMsgStatusCode("pricing failed", "refused", "502"))
+	require.Equal(t, "pricing failed refused StatusCode:502", list.Error())
+
+	list.Add(WithErrorAndCause(context.DeadlineExceeded, "stock failed"))
+	require.Equal(t, "2 errors: pricing failed refused StatusCode:502; stock failed context deadline exceeded", list.Error())
+	require.Equal(t, list.Error(), fmt.Sprintf("%v", list))
+	require.Equal(t, fmt.Sprintf("%q", list.Error()), fmt.Sprintf("%q", list))
+	detailed := fmt.Sprintf("%+v", list)
+	require.Contains(t, detailed, "2 errors:\npricing failed StatusCode:502 refused\n")
+	require.Contains(t, detailed, "\nstock failed context deadline exceeded")
+}
+
+func Test_List_AddKeepsWrappers(t *testing.T) {
+	pricing := NewRootMsgStatusCode("backend failed", "refused", "502")
+	list := &List{}
+	list.Add(fmt.Errorf("pricing backend: %w", pricing))
+	list.Add(pricing)
+
+	errs := list.Errors()
+	require.Len(t, errs, 2)
+	require.Equal(t, "pricing backend: backend failed refused StatusCode:502", errs[0].Error())
+	require.True(t, Is(errs[0], &ErrorLog{StatusCode: "502"}))
+	require.Same(t, pricing, errs[1])
+}
+
+func Test_List_AddTypedNil(t *testing.T) {
+	list := &List{}
+	list.Add(WithErrorAndCause(nil, "backend a"))
+	list.Add(FromError(nil))
+	list.Add(NewRootMsgStatusCode("backend b failed", "refused", "502"))
+
+	require.Equal(t, 1, list.Len())
+	require.Equal(t, 3, list.Attempts())
+	require.True(t, list.PartialFailure())
+	require.False(t, list.TotalFailure())
+	require.Equal(t, "backend b failed refused StatusCode:502", list.Error())
+	require.Equal(t, list.Error(), fmt.Sprintf("%v", list))
+	require.Contains(t, fmt.Sprintf("%+v", list), "1 errors:\nbackend b failed StatusCode:502 refused")
+	bytes, err := json.Marshal(list)
+	require.NoError(t, err)
+	require.Equal(t, `[{"Trace":"refused","RootCause":"backend b failed","StatusCode":"502"}]`, string(bytes))
+
+	successes := &List{}
+	successes.Add(WithErrorAndCause(nil, "backend a"))
+	require.NoError(t, successes.Err())
+	require.False(t, successes.TotalFailure())
+}
+
+func Test_List_Unwrap(t *testing.T) {
+	list := &List{}
+	list.Add(NewCode(CodeUnavailable, "pricing down"))
+	list.Add(WithErrorAndCause(context.DeadlineExceeded, "stock failed"))
+	err := fmt.Errorf("aggregating: %w", list.Err())
+
+	require.True(t, Is(err, context.DeadlineExceeded))
+	require.True(t, Is(err, &ErrorLog{Code: CodeUnavailable}))
+	require.False(t, Is(err, context.Canceled))
+	require.Equal(t, CodeUnavailable, CodeOf(err))
+	list2 := &List{}
+	require.True(t, As(err, &list2))
+	require.Equal(t, 2, list2.Len())
+}
+
+func Test_List_MarshalJSON(t *testing.T) {
+	list := &List{}
+	bytes, err := json.Marshal(list)
+	require.NoError(t, err)
+	require.Equal(t, `[]`, string(bytes))
+
+	list.Add(NewRootMsgStatusCode("pricing failed", "refused", "502"))
+	list.Add(&ErrorLog{RootCause: "stock failed", Source: "stock"})
+	bytes, err = json.Marshal(list)
+	require.NoError(t, err)
+	require.Equal(t, `[{"Trace":"refused","RootCause":"pricing failed","StatusCode":"502"},{"Trace":"","RootCause":"stock failed","Source":"stock"}]`, string(bytes))
+}
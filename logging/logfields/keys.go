@@ -25,12 +25,15 @@ const (
 	ErrorsCount   = "errorsCount"
 	RequestURL    = "requestURL"
 	ServiceName   = "serviceName"
+	HealthCheck   = "healthCheck"
 )
 
 // Common fields for error logs
 const (
 	RootCause   = "rootCause"
 	ErrorSource = "errorSource"
+	Panic       = "panic"
+	Stack       = "stack"
 )
 
 // Common fields testing logs
@@ -21,6 +21,17 @@ const (
 	ErrorLevel
 )
 
+// String returns the name of the level as accepted by
+// ConfigureDefaultLoggingFromString and SetLevelFromString
+func (level Level) String() string {
+	for levelStr, loggingLevel := range levelStrToLoggingLevel {
+		if loggingLevel == level {
+			return levelStr
+		}
+	}
+	return fmt.Sprintf("Level(%d)", int(level))
+}
+
 var levelToConst map[Level]logrus.Level
 var levelStrToLoggingLevel map[string]Level
 var defaultLogger *Logger
@@ -109,6 +120,21 @@ func (l *Logger) SetLevel(loggingLevel Level) {
 	l.LoggerImpl.SetLevel(convertLoggingLevelToConst(loggingLevel))
 }
 
+// GetLevel returns the current logging Level, logrus levels which have
+// no Level equivalent are mapped to the nearest Level
+func (l *Logger) GetLevel() Level {
+	switch logrusLevel := l.LoggerImpl.GetLevel(); {
+	case logrusLevel >= logrus.TraceLevel:
+		return TraceLevel
+	case logrusLevel >= logrus.InfoLevel: // includes debug
+		return InfoLevel
+	case logrusLevel == logrus.WarnLevel:
+		return WarningLevel
+	default: // error, fatal, panic
+		return ErrorLevel
+	}
+}
+
 func (l *Logger) Trace(args ...interface{}) {
 	l.LoggerImpl.Trace(args...)
 }
@@ -147,6 +173,22 @@ func SetLevel(loggingLevel Level) {
 	defaultLogger.SetLevel(loggingLevel)
 }
 
+// SetLevelFromString sets the level of the default logger from one of
+// "trace", "info", "warn" or "error"
+func SetLevelFromString(loggingLevelStr string) error {
+	loggingLevel, err := convertLoggingLevelStrToLoggingLevel(loggingLevelStr)
+	if err != nil {
+		return err
+	}
+	defaultLogger.SetLevel(loggingLevel)
+	return nil
+}
+
+// GetLevel returns the level of the default logger
+func GetLevel() Level {
+	return defaultLogger.GetLevel()
+}
+
 func Trace(args ...interface{}) {
 	defaultLogger.Trace(args...)
 }
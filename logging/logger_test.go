@@ -278,3 +278,35 @@ func (c mockContext) Err() error {
 func (c mockContext) Value(key interface{}) interface{} {
 	return c.Values[key]
 }
+
+func Test_LevelStringAndGetLevel(t *testing.T) {
+	testcases := []struct {
+		name         string
+		levelStr     string
+		logrusLevel  logrus.Level
+		expected     Level
+		expectedName string
+	}{
+		{name: "trace", levelStr: "trace", logrusLevel: logrus.TraceLevel, expected: TraceLevel, expectedName: "trace"},
+		{name: "debug maps to info", logrusLevel: logrus.DebugLevel, expected: InfoLevel, expectedName: "info"},
+		{name: "info", levelStr: "info", logrusLevel: logrus.InfoLevel, expected: InfoLevel, expectedName: "info"},
+		{name: "warn", levelStr: "warn", logrusLevel: logrus.WarnLevel, expected: WarningLevel, expectedName: "warn"},
+		{name: "error", levelStr: "error", logrusLevel: logrus.ErrorLevel, expected: ErrorLevel, expectedName: "error"},
+		{name: "fatal maps to error", logrusLevel: logrus.FatalLevel, expected: ErrorLevel, expectedName: "error"},
+	}
+	defer SetLevel(ErrorLevel)
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.levelStr != "" {
+				require.NoError(t, SetLevelFromString(tc.levelStr))
+			} else {
+				DefaultLogger().LoggerImpl.SetLevel(tc.logrusLevel)
+			}
+			require.Equal(t, tc.logrusLevel, DefaultLogger().LoggerImpl.GetLevel())
+			require.Equal(t, tc.expected, GetLevel())
+			require.Equal(t, tc.expectedName, GetLevel().String())
+		})
+	}
+	require.EqualError(t, SetLevelFromString("verbose"), "invalid level specified:verbose")
+	require.Equal(t, "Level(9)", Level(9).String())
+}
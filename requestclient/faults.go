@@ -0,0 +1,339 @@
+package requestclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodeNamor/Common/logging"
+	"github.com/pkg/errors"
+)
+
+// ErrFaultInjected is the cause of connection errors injected by a FaultClient
+var ErrFaultInjected = errors.New("fault injected connection error")
+
+// malformed payloads returned by rules with Malformed set
+var malformedBodies = map[string]string{
+	"xml":  `<?xml version="1.0" encoding="utf-8"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><Broken>`,
+	"json": `{"broken": [1, 2,`,
+}
+
+// Duration is a time.Duration which is read from and written to JSON
+// as a string such as "250ms" or "1.5s"
+type Duration time.Duration
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON reads the duration from a string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, "duration must be a string such as \"250ms\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.Wrapf(err, "invalid duration %q", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// FaultRule describes a fault to inject into matching requests. Empty
+// match fields match everything. When a rule fires, Latency is applied
+// first, then either a ConnectionError or a synthesized StatusCode
+// response is returned without calling the service, otherwise the
+// service is called and TruncateBody or Malformed alter its response.
+type FaultRule struct {
+	Name        string  `json:"name"`
+	Enabled     bool    `json:"enabled"`
+	Host        string  `json:"host,omitempty"`       // matches req.URL.Host or req.URL.Hostname()
+	Path        string  `json:"path,omitempty"`       // matches paths with this prefix
+	SOAPAction  string  `json:"soapAction,omitempty"` // matches the SOAPAction header
+	Probability float64 `json:"probability"`          // 0 to 1, chance that a matching request is faulted
+
+	Latency         Duration `json:"latency,omitempty"`
+	ConnectionError bool     `json:"connectionError,omitempty"`
+	StatusCode      int      `json:"statusCode,omitempty"`
+	TruncateBody    bool     `json:"truncateBody,omitempty"` // return half the body then io.ErrUnexpectedEOF
+	Malformed       string   `json:"malformed,omitempty"`    // "xml" or "json" replaces the body with broken content
+}
+
+// Validate checks the rule is well formed
+func (r FaultRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("fault rule name is required")
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return errors.Errorf("fault rule %s probability must be between 0 and 1", r.Name)
+	}
+	if r.Latency < 0 {
+		return errors.Errorf("fault rule %s latency must not be negative", r.Name)
+	}
+	if r.StatusCode != 0 && (r.StatusCode < 100 || r.StatusCode > 599) {
+		return errors.Errorf("fault rule %s has invalid statusCode %d", r.Name, r.StatusCode)
+	}
+	if _, ok := malformedBodies[r.Malformed]; r.Malformed != "" && !ok {
+		return errors.Errorf("fault rule %s malformed must be xml or json", r.Name)
+	}
+	return nil
+}
+
+func (r FaultRule) matches(req *http.Request) bool {
+	if r.Host != "" && r.Host != req.URL.Host && r.Host != req.URL.Hostname() {
+		return false
+	}
+	if r.Path != "" && !strings.HasPrefix(req.URL.Path, r.Path) {
+		return false
+	}
+	if r.SOAPAction != "" && r.SOAPAction != strings.Trim(req.Header.Get("SOAPAction"), `"`) {
+		return false
+	}
+	return true
+}
+
+// LoadFaultRules reads a JSON array of FaultRule from filePath
+func LoadFaultRules(filePath string) ([]FaultRule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read fault rules file %s", filePath)
+	}
+	rules := []FaultRule{}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, errors.Wrapf(err, "unable to decode fault rules file %s", filePath)
+	}
+	if err := validateFaultRules(rules); err != nil {
+		return nil, errors.Wrapf(err, "invalid fault rules file %s", filePath)
+	}
+	return rules, nil
+}
+
+func validateFaultRules(rules []FaultRule) error {
+	names := map[string]bool{}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+		if names[rule.Name] {
+			return errors.Errorf("duplicate fault rule name %s", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return nil
+}
+
+// FaultClient is a RequestClient which injects faults described by
+// FaultRules into requests before or after calling the wrapped
+// RequestClient. Rules are evaluated in order and the first matching
+// enabled rule which fires is applied. It is intended for chaos and
+// resilience testing and should not be used in production.
+type FaultClient struct {
+	next RequestClient
+
+	mu     sync.RWMutex
+	rules  []FaultRule
+	random func() float64
+}
+
+// NewFaultClient wraps next in a FaultClient using rules, it
+// returns an error if any rule is invalid
+func NewFaultClient(next RequestClient, rules ...FaultRule) (*FaultClient, error) {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	rndMu := sync.Mutex{}
+	c := &FaultClient{
+		next: next,
+		random: func() float64 {
+			rndMu.Lock()
+			defer rndMu.Unlock()
+			return rnd.Float64()
+		},
+	}
+	if err := c.SetRules(rules); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Rules returns a copy of the current rules
+func (c *FaultClient) Rules() []FaultRule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]FaultRule{}, c.rules...)
+}
+
+// SetRules replaces all of the rules
+func (c *FaultClient) SetRules(rules []FaultRule) error {
+	if err := validateFaultRules(rules); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = append([]FaultRule{}, rules...)
+	return nil
+}
+
+// SetEnabled enables or disables the named rule
+func (c *FaultClient) SetEnabled(name string, enabled bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.rules {
+		if c.rules[i].Name == name {
+			c.rules[i].Enabled = enabled
+			return nil
+		}
+	}
+	return errors.Errorf("fault rule %s not found", name)
+}
+
+// Do applies the first matching rule which fires and otherwise calls
+// the wrapped RequestClient
+func (c *FaultClient) Do(req *http.Request) (*http.Response, error) {
+	rule, ok := c.selectRule(req)
+	if !ok {
+		return c.next.Do(req)
+	}
+	logging.Trace("fault rule ", rule.Name, " injected into request url: ", req.URL.Redacted())
+
+	if rule.Latency > 0 {
+		timer := time.NewTimer(time.Duration(rule.Latency))
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			closeRequestBody(req)
+			return nil, req.Context().Err()
+		}
+	}
+
+	if rule.ConnectionError {
+		closeRequestBody(req)
+		return nil, &url.Error{Op: urlErrorOp(req.Method), URL: req.URL.Redacted(), Err: ErrFaultInjected}
+	}
+
+	if rule.StatusCode != 0 {
+		closeRequestBody(req)
+		body := http.StatusText(rule.StatusCode)
+		if rule.Malformed != "" {
+			body = malformedBodies[rule.Malformed]
+		}
+		res := &http.Response{
+			Status:        strconv.Itoa(rule.StatusCode) + " " + http.StatusText(rule.StatusCode),
+			StatusCode:    rule.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"X-Fault-Rule": []string{rule.Name}},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}
+		return res, nil
+	}
+
+	res, err := c.next.Do(req)
+	if err != nil || res == nil || (!rule.TruncateBody && rule.Malformed == "") {
+		return res, err
+	}
+
+	if rule.Malformed != "" {
+		res.Body.Close()
+		body := malformedBodies[rule.Malformed]
+		res.Body = io.NopCloser(strings.NewReader(body))
+		res.ContentLength = int64(len(body))
+		return res, nil
+	}
+
+	original, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(io.MultiReader(bytes.NewReader(original[:len(original)/2]), errReader{io.ErrUnexpectedEOF}))
+	res.ContentLength = -1
+	return res, nil
+}
+
+// closeRequestBody closes the body of a request which is not sent, as
+// a transport would
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func (c *FaultClient) selectRule(req *http.Request) (FaultRule, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, rule := range c.rules {
+		if rule.Enabled && rule.matches(req) && c.random() < rule.Probability {
+			return rule, true
+		}
+	}
+	return FaultRule{}, false
+}
+
+// AdminHandler returns a handler to view and change the rules at runtime
+//
+//	GET                            returns the rules as JSON
+//	PUT  (JSON array body)         replaces all of the rules
+//	POST ?name=rule&enabled=false  enables or disables a rule
+func (c *FaultClient) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			rules := []FaultRule{}
+			if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&rules); err != nil {
+				http.Error(w, "invalid fault rules: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := c.SetRules(rules); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodPost:
+			enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+			if err != nil {
+				http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+				return
+			}
+			if err := c.SetEnabled(r.URL.Query().Get("name"), enabled); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Rules())
+	})
+}
+
+// urlErrorOp mirrors the Op net/http uses in the *url.Error it returns
+func urlErrorOp(method string) string {
+	if method == "" {
+		return "Get"
+	}
+	return method[:1] + strings.ToLower(method[1:])
+}
+
+// errReader is a reader which always fails with err
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
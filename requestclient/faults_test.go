@@ -0,0 +1,233 @@
+package requestclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newBackend(t *testing.T, body string) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func Test_FaultClient_Do(t *testing.T) {
+	backend := newBackend(t, `{"message":"hello world"}`)
+
+	testcases := []struct {
+		name         string
+		rule         FaultRule
+		path         string
+		soapAction   string
+		expectErr    error
+		expectStatus int
+		expectBody   string
+		expectReadEr error
+	}{
+		{
+			name:         "no match passes through",
+			rule:         FaultRule{Name: "r", Enabled: true, Path: "/other", Probability: 1, StatusCode: 500},
+			path:         "/api",
+			expectStatus: 200,
+			expectBody:   `{"message":"hello world"}`,
+		},
+		{
+			name:         "disabled passes through",
+			rule:         FaultRule{Name: "r", Probability: 1, StatusCode: 500},
+			path:         "/api",
+			expectStatus: 200,
+			expectBody:   `{"message":"hello world"}`,
+		},
+		{
+			name:         "zero probability passes through",
+			rule:         FaultRule{Name: "r", Enabled: true, StatusCode: 500},
+			path:         "/api",
+			expectStatus: 200,
+			expectBody:   `{"message":"hello world"}`,
+		},
+		{
+			name:      "connection error",
+			rule:      FaultRule{Name: "r", Enabled: true, Path: "/api", Probability: 1, ConnectionError: true},
+			path:      "/api/items",
+			expectErr: ErrFaultInjected,
+		},
+		{
+			name:         "status code",
+			rule:         FaultRule{Name: "r", Enabled: true, SOAPAction: "GetData", Probability: 1, StatusCode: 503},
+			path:         "/api",
+			soapAction:   "GetData",
+			expectStatus: 503,
+			expectBody:   "Service Unavailable",
+		},
+		{
+			name:         "malformed json",
+			rule:         FaultRule{Name: "r", Enabled: true, Probability: 1, Malformed: "json"},
+			path:         "/api",
+			expectStatus: 200,
+			expectBody:   malformedBodies["json"],
+		},
+		{
+			name:         "truncated body",
+			rule:         FaultRule{Name: "r", Enabled: true, Probability: 1, TruncateBody: true},
+			path:         "/api",
+			expectStatus: 200,
+			expectBody:   `{"message":"`,
+			expectReadEr: io.ErrUnexpectedEOF,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewFaultClient(http.DefaultClient, tc.rule)
+			require.NoError(t, err)
+			req, _ := http.NewRequest(http.MethodGet, backend.URL+tc.path, nil)
+			if tc.soapAction != "" {
+				req.Header.Set("SOAPAction", tc.soapAction)
+			}
+
+			res, err := client.Do(req)
+			if tc.expectErr != nil {
+				require.True(t, errors.Is(err, tc.expectErr), "unexpected err %v", err)
+				return
+			}
+			require.NoError(t, err)
+			defer res.Body.Close()
+			require.Equal(t, tc.expectStatus, res.StatusCode)
+			body, err := io.ReadAll(res.Body)
+			require.Equal(t, tc.expectReadEr, err)
+			require.Equal(t, tc.expectBody, string(body))
+		})
+	}
+}
+
+func Test_FaultClient_LatencyHonorsContext(t *testing.T) {
+	backend := newBackend(t, "ok")
+	client, err := NewFaultClient(http.DefaultClient,
+		FaultRule{Name: "slow", Enabled: true, Probability: 1, Latency: Duration(time.Minute)})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, backend.URL, nil)
+	_, err = client.Do(req)
+	require.Equal(t, context.DeadlineExceeded, err)
+}
+
+// closeTrackingBody records whether it was closed
+type closeTrackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeTrackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func Test_FaultClient_ClosesRequestBody(t *testing.T) {
+	backend := newBackend(t, "ok")
+	testcases := []struct {
+		name string
+		rule FaultRule
+	}{
+		{name: "connection error", rule: FaultRule{Name: "down", Enabled: true, Probability: 1, ConnectionError: true}},
+		{name: "status", rule: FaultRule{Name: "500", Enabled: true, Probability: 1, StatusCode: 500}},
+		{name: "cancelled", rule: FaultRule{Name: "slow", Enabled: true, Probability: 1, Latency: Duration(time.Minute)}},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewFaultClient(http.DefaultClient, tc.rule)
+			require.NoError(t, err)
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			body := &closeTrackingBody{Reader: strings.NewReader("payload")}
+			req, _ := http.NewRequestWithContext(ctx, http.MethodPost, backend.URL, body)
+			res, _ := client.Do(req)
+			if res != nil {
+				res.Body.Close()
+			}
+			require.True(t, body.closed)
+		})
+	}
+}
+
+func Test_FaultClient_Probability(t *testing.T) {
+	backend := newBackend(t, "ok")
+	client, err := NewFaultClient(http.DefaultClient,
+		FaultRule{Name: "half", Enabled: true, Probability: 0.5, StatusCode: 500})
+	require.NoError(t, err)
+	rolls := []float64{0.2, 0.7}
+	client.random = func() float64 {
+		roll := rolls[0]
+		rolls = rolls[1:]
+		return roll
+	}
+
+	for _, expected := range []int{500, 200} {
+		req, _ := http.NewRequest(http.MethodGet, backend.URL, nil)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, expected, res.StatusCode)
+	}
+}
+
+func Test_LoadFaultRules(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	os.WriteFile(valid, []byte(`[{"name":"slow","enabled":true,"host":"example.com","probability":0.1,"latency":"250ms"}]`), 0600)
+	invalid := filepath.Join(dir, "invalid.json")
+	os.WriteFile(invalid, []byte(`[{"name":"bad","probability":2}]`), 0600)
+
+	rules, err := LoadFaultRules(valid)
+	require.NoError(t, err)
+	require.Equal(t, []FaultRule{{Name: "slow", Enabled: true, Host: "example.com", Probability: 0.1, Latency: Duration(250 * time.Millisecond)}}, rules)
+
+	_, err = LoadFaultRules(invalid)
+	require.Error(t, err)
+	_, err = LoadFaultRules(filepath.Join(dir, "missing.json"))
+	require.Error(t, err)
+}
+
+func Test_FaultClient_AdminHandler(t *testing.T) {
+	client, err := NewFaultClient(http.DefaultClient, FaultRule{Name: "slow", Probability: 1})
+	require.NoError(t, err)
+	handler := client.AdminHandler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/faults?name=slow&enabled=true", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, client.Rules()[0].Enabled)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/faults?name=missing&enabled=true", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	body := `[{"name":"err","enabled":true,"probability":1,"connectionError":true}]`
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/faults", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/faults", nil))
+	rules := []FaultRule{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rules))
+	require.Equal(t, []FaultRule{{Name: "err", Enabled: true, Probability: 1, ConnectionError: true}}, rules)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/faults", strings.NewReader(`[{"probability":1}]`)))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
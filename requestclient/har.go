@@ -0,0 +1,501 @@
+package requestclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultHARCapacity is how many entries a HARRecorder keeps by default
+	DefaultHARCapacity = 100
+	// DefaultHARMaxBodySize is how much of each body a HARRecorder keeps by default
+	DefaultHARMaxBodySize = 64 << 10
+	// harRedacted replaces redacted header values
+	harRedacted = "[REDACTED]"
+)
+
+// defaultRedactedHeaders are always redacted since they carry credentials
+var defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// HAR is the root of an HTTP Archive 1.2 document (http://www.softwareishard.com/blog/har-12-spec/)
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the log object of a HAR document
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator identifies the application which created the HAR document
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single request and response pair
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"` // total milliseconds
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+// HARRequest describes the request sent
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse describes the response received
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARNameValue is a header, query parameter or cookie
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the request body, HAR has no encoding for it so a
+// body which is not valid utf-8 is base64 encoded and the Comment
+// says so
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARContent is the response body
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are the phases of the request in milliseconds
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// bodyRedaction replaces matches of pattern in bodies
+type bodyRedaction struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+type harOptions struct {
+	capacity       int
+	maxBodySize    int
+	redactHeaders  map[string]bool
+	bodyRedactions []bodyRedaction
+}
+
+// A HAROption sets options for a HARRecorder
+type HAROption func(*harOptions)
+
+// WithHARCapacity is a HAROption to set how many of the most recent
+// entries are kept, defaults to DefaultHARCapacity
+func WithHARCapacity(capacity int) HAROption {
+	return func(o *harOptions) {
+		o.capacity = capacity
+	}
+}
+
+// WithHARMaxBodySize is a HAROption to set how many bytes of each
+// request and response body are kept, defaults to DefaultHARMaxBodySize
+func WithHARMaxBodySize(maxBytes int) HAROption {
+	return func(o *harOptions) {
+		o.maxBodySize = maxBytes
+	}
+}
+
+// WithRedactedHeaders is a HAROption to redact the values of the named
+// headers in addition to Authorization, Proxy-Authorization, Cookie
+// and Set-Cookie
+func WithRedactedHeaders(names ...string) HAROption {
+	return func(o *harOptions) {
+		for _, name := range names {
+			o.redactHeaders[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+}
+
+// WithBodyRedaction is a HAROption to replace matches of pattern in
+// request and response bodies and urls with replacement, which may
+// reference submatches as in regexp.ReplaceAllString
+func WithBodyRedaction(pattern *regexp.Regexp, replacement string) HAROption {
+	return func(o *harOptions) {
+		o.bodyRedactions = append(o.bodyRedactions, bodyRedaction{pattern: pattern, replacement: replacement})
+	}
+}
+
+// HARRecorder keeps the most recent request and response pairs in a
+// ring buffer so it is bounded and safe to leave enabled. It is an
+// http.Handler which serves the HAR document, and DELETE clears it.
+type HARRecorder struct {
+	opts harOptions
+
+	mu      sync.Mutex
+	entries []HAREntry
+	next    int // index the next entry is written to
+	full    bool
+}
+
+// NewHARRecorder creates a HARRecorder
+func NewHARRecorder(opt ...HAROption) *HARRecorder {
+	opts := harOptions{
+		capacity:      DefaultHARCapacity,
+		maxBodySize:   DefaultHARMaxBodySize,
+		redactHeaders: map[string]bool{},
+	}
+	for _, name := range defaultRedactedHeaders {
+		opts.redactHeaders[name] = true
+	}
+	for _, o := range opt {
+		o(&opts)
+	}
+	if opts.capacity < 1 {
+		opts.capacity = 1
+	}
+	return &HARRecorder{
+		opts:    opts,
+		entries: make([]HAREntry, opts.capacity),
+	}
+}
+
+// HAR returns a HAR document of the recorded entries, oldest first
+func (r *HARRecorder) HAR() *HAR {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := []HAREntry{}
+	if r.full {
+		entries = append(entries, r.entries[r.next:]...)
+	}
+	entries = append(entries, r.entries[:r.next]...)
+	return &HAR{
+		Log: HARLog{
+			Version: "1.2",
+			Creator: HARCreator{Name: "github.com/CodeNamor/Common/requestclient", Version: "1.0"},
+			Entries: entries,
+		},
+	}
+}
+
+// Reset clears the recorded entries
+func (r *HARRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = make([]HAREntry, r.opts.capacity)
+	r.next = 0
+	r.full = false
+}
+
+// WriteFile writes the HAR document as JSON to filePath
+func (r *HARRecorder) WriteFile(filePath string) error {
+	data, err := json.MarshalIndent(r.HAR(), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to encode HAR")
+	}
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		return errors.Wrapf(err, "unable to write HAR file %s", filePath)
+	}
+	return nil
+}
+
+// ServeHTTP serves the HAR document on GET and clears it on DELETE
+func (r *HARRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="requests.har"`)
+		json.NewEncoder(w).Encode(r.HAR())
+	case http.MethodDelete:
+		r.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *HARRecorder) add(entry HAREntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+func (r *HARRecorder) redactBody(text string) string {
+	for _, redaction := range r.opts.bodyRedactions {
+		text = redaction.pattern.ReplaceAllString(text, redaction.replacement)
+	}
+	return text
+}
+
+func (r *HARRecorder) nameValues(header http.Header) []HARNameValue {
+	nameValues := []HARNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			if r.opts.redactHeaders[http.CanonicalHeaderKey(name)] {
+				value = harRedacted
+			}
+			nameValues = append(nameValues, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return nameValues
+}
+
+// content converts a captured body into redacted text, base64
+// encoding it if it is not valid utf-8, and notes if it was truncated.
+// A truncated body is cut back to a character boundary so a multibyte
+// character split by the limit does not make it binary.
+func (r *HARRecorder) content(body []byte, size int64) (text string, encoding string, comment string) {
+	if size > int64(len(body)) {
+		comment = "body truncated"
+		body = trimPartialRune(body)
+	}
+	text = r.redactBody(string(body))
+	if utf8.ValidString(text) {
+		return text, "", comment
+	}
+	return base64.StdEncoding.EncodeToString([]byte(text)), "base64", comment
+}
+
+// trimPartialRune removes an incomplete utf-8 character from the end
+// of body
+func trimPartialRune(body []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(body); i++ {
+		if utf8.RuneStart(body[len(body)-i]) {
+			if !utf8.FullRune(body[len(body)-i:]) {
+				return body[:len(body)-i]
+			}
+			break
+		}
+	}
+	return body
+}
+
+// HARClient is a RequestClient which records each request and
+// response pair into a HARRecorder
+type HARClient struct {
+	next     RequestClient
+	recorder *HARRecorder
+}
+
+// NewHARClient wraps next in a HARClient recording into recorder
+func NewHARClient(next RequestClient, recorder *HARRecorder) *HARClient {
+	return &HARClient{
+		next:     next,
+		recorder: recorder,
+	}
+}
+
+// Do calls the wrapped RequestClient and records the exchange. The
+// entry is added once the response body has been read to the end or
+// closed, so the receive timing and body are complete.
+func (c *HARClient) Do(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	entry := HAREntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Request:         c.harRequest(req),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, size, err := c.captureRequestBody(req)
+		if err != nil {
+			return nil, err
+		}
+		text, encoding, comment := c.recorder.content(body, size)
+		if encoding != "" {
+			comment = strings.TrimPrefix(comment+", "+encoding+" encoded", ", ")
+		}
+		entry.Request.BodySize = size
+		entry.Request.PostData = &HARPostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     text,
+			Comment:  comment,
+		}
+	}
+
+	res, err := c.next.Do(req)
+	entry.Timings.Wait = milliseconds(time.Since(started))
+	if err != nil {
+		entry.Comment = "error: " + c.recorder.redactBody(err.Error())
+		entry.Time = entry.Timings.Wait
+		entry.Response = HARResponse{Cookies: []HARNameValue{}, Headers: []HARNameValue{}, HeadersSize: -1, BodySize: -1}
+		c.recorder.add(entry)
+		return res, err
+	}
+
+	entry.Response = HARResponse{
+		Status:      res.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(res.Status, strconv.Itoa(res.StatusCode))),
+		HTTPVersion: res.Proto,
+		Cookies:     []HARNameValue{},
+		Headers:     c.recorder.nameValues(res.Header),
+		Content:     HARContent{MimeType: res.Header.Get("Content-Type")},
+		RedirectURL: res.Header.Get("Location"),
+		HeadersSize: -1,
+	}
+	if entry.Response.StatusText == "" {
+		entry.Response.StatusText = http.StatusText(res.StatusCode)
+	}
+	received := time.Now()
+	res.Body = &harBodyCapture{
+		ReadCloser: res.Body,
+		maxSize:    c.recorder.opts.maxBodySize,
+		done: func(body []byte, size int64) {
+			entry.Timings.Receive = milliseconds(time.Since(received))
+			entry.Time = entry.Timings.Send + entry.Timings.Wait + entry.Timings.Receive
+			entry.Response.BodySize = size
+			entry.Response.Content.Size = size
+			entry.Response.Content.Text, entry.Response.Content.Encoding, entry.Response.Content.Comment = c.recorder.content(body, size)
+			c.recorder.add(entry)
+		},
+	}
+	return res, nil
+}
+
+func (c *HARClient) harRequest(req *http.Request) HARRequest {
+	harReq := HARRequest{
+		Method:      req.Method,
+		URL:         c.recorder.redactBody(req.URL.Redacted()),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []HARNameValue{},
+		Headers:     c.recorder.nameValues(req.Header),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			harReq.QueryString = append(harReq.QueryString, HARNameValue{Name: name, Value: c.recorder.redactBody(value)})
+		}
+	}
+	return harReq
+}
+
+// captureRequestBody returns up to maxBodySize bytes of the request
+// body and its total size. GetBody is used when available so the
+// body sent is untouched, otherwise the body is read and replaced.
+func (c *HARClient) captureRequestBody(req *http.Request) ([]byte, int64, error) {
+	var body io.ReadCloser
+	if req.GetBody != nil {
+		var err error
+		if body, err = req.GetBody(); err != nil {
+			return nil, 0, errors.Wrap(err, "unable to capture request body")
+		}
+	} else {
+		raw, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "unable to capture request body")
+		}
+		req.Body = io.NopCloser(bytes.NewReader(raw))
+		body = io.NopCloser(bytes.NewReader(raw))
+	}
+	defer body.Close()
+	captured := &bytes.Buffer{}
+	size, err := io.Copy(&limitedBuffer{buffer: captured, limit: c.recorder.opts.maxBodySize}, body)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "unable to capture request body")
+	}
+	return captured.Bytes(), size, nil
+}
+
+// harBodyCapture keeps the first maxSize bytes read from a response
+// body and calls done once at EOF or Close
+type harBodyCapture struct {
+	io.ReadCloser
+	maxSize  int
+	captured bytes.Buffer
+	size     int64
+	once     sync.Once
+	done     func(body []byte, size int64)
+}
+
+func (b *harBodyCapture) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if remaining := b.maxSize - b.captured.Len(); remaining > 0 {
+		if remaining > n {
+			remaining = n
+		}
+		b.captured.Write(p[:remaining])
+	}
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *harBodyCapture) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *harBodyCapture) finish() {
+	b.once.Do(func() {
+		b.done(b.captured.Bytes(), b.size)
+	})
+}
+
+// limitedBuffer is a writer which keeps only the first limit bytes but
+// reports everything as written so io.Copy counts the full size
+type limitedBuffer struct {
+	buffer *bytes.Buffer
+	limit  int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := l.limit - l.buffer.Len(); remaining > 0 {
+		if remaining > len(p) {
+			remaining = len(p)
+		}
+		l.buffer.Write(p[:remaining])
+	}
+	return len(p), nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,190 @@
+package requestclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func harGet(t *testing.T, client RequestClient, url string) string {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	return string(body)
+}
+
+func headerValue(nameValues []HARNameValue, name string) string {
+	for _, nv := range nameValues {
+		if strings.EqualFold(nv.Name, name) {
+			return nv.Value
+		}
+	}
+	return ""
+}
+
+func Test_HARClient_Records(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"echo":` + string(body) + `}`))
+	}))
+	defer backend.Close()
+
+	recorder := NewHARRecorder(
+		WithRedactedHeaders("X-Api-Key"),
+		WithBodyRedaction(regexp.MustCompile(`"password":"[^"]*"`), `"password":"***"`),
+	)
+	client := NewHARClient(http.DefaultClient, recorder)
+
+	req, _ := http.NewRequest(http.MethodPost, backend.URL+"/login?user=bob", strings.NewReader(`{"password":"hunter2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("X-Api-Key", "key")
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.Equal(t, `{"echo":{"password":"hunter2"}}`, string(body), "caller must see the unredacted body")
+
+	har := recorder.HAR()
+	require.Equal(t, "1.2", har.Log.Version)
+	require.Len(t, har.Log.Entries, 1)
+	entry := har.Log.Entries[0]
+	require.Equal(t, http.MethodPost, entry.Request.Method)
+	require.Equal(t, []HARNameValue{{Name: "user", Value: "bob"}}, entry.Request.QueryString)
+	require.Equal(t, harRedacted, headerValue(entry.Request.Headers, "Authorization"))
+	require.Equal(t, harRedacted, headerValue(entry.Request.Headers, "X-Api-Key"))
+	require.Equal(t, `{"password":"***"}`, entry.Request.PostData.Text)
+	require.Equal(t, int64(22), entry.Request.BodySize)
+	require.Equal(t, http.StatusCreated, entry.Response.Status)
+	require.Equal(t, "Created", entry.Response.StatusText)
+	require.Equal(t, harRedacted, headerValue(entry.Response.Headers, "Set-Cookie"))
+	require.Equal(t, `{"echo":{"password":"***"}}`, entry.Response.Content.Text)
+	require.Equal(t, "application/json", entry.Response.Content.MimeType)
+	require.Equal(t, entry.Timings.Wait+entry.Timings.Receive, entry.Time)
+}
+
+func Test_HARRecorder_RingBufferAndTruncation(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + "-0123456789"))
+	}))
+	defer backend.Close()
+
+	recorder := NewHARRecorder(WithHARCapacity(2), WithHARMaxBodySize(4))
+	client := NewHARClient(http.DefaultClient, recorder)
+	for _, path := range []string{"/a", "/b", "/c"} {
+		require.Equal(t, path+"-0123456789", harGet(t, client, backend.URL+path))
+	}
+
+	entries := recorder.HAR().Log.Entries
+	require.Len(t, entries, 2)
+	require.Equal(t, backend.URL+"/b", entries[0].Request.URL)
+	require.Equal(t, backend.URL+"/c", entries[1].Request.URL)
+	require.Equal(t, "/c-0", entries[1].Response.Content.Text)
+	require.Equal(t, int64(13), entries[1].Response.Content.Size)
+	require.Equal(t, "body truncated", entries[1].Response.Content.Comment)
+
+	recorder.Reset()
+	require.Len(t, recorder.HAR().Log.Entries, 0)
+}
+
+func Test_HARRecorder_RedactsTruncatedAndBinaryBodies(t *testing.T) {
+	bodies := map[string][]byte{
+		"/text":   []byte(`{"password":"hunter2","name":"Zoë"}`),
+		"/binary": append([]byte{0xff, 0xfe}, `{"password":"hunter2"}`...),
+	}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bodies[r.URL.Path])
+	}))
+	defer backend.Close()
+
+	// the limit splits the two byte ë
+	maxBodySize := strings.Index(string(bodies["/text"]), "ë") + 1
+	recorder := NewHARRecorder(
+		WithHARMaxBodySize(maxBodySize),
+		WithBodyRedaction(regexp.MustCompile(`"password":"[^"]*"`), `"password":"***"`),
+	)
+	client := NewHARClient(http.DefaultClient, recorder)
+	harGet(t, client, backend.URL+"/text")
+	harGet(t, client, backend.URL+"/binary")
+
+	entries := recorder.HAR().Log.Entries
+	require.Len(t, entries, 2)
+	text := entries[0].Response.Content
+	require.Equal(t, "", text.Encoding)
+	require.Equal(t, `{"password":"***","name":"Zo`, text.Text)
+	require.Equal(t, "body truncated", text.Comment)
+
+	binary := entries[1].Response.Content
+	require.Equal(t, "base64", binary.Encoding)
+	decoded, err := base64.StdEncoding.DecodeString(binary.Text)
+	require.NoError(t, err)
+	require.NotContains(t, string(decoded), "hunter2")
+	require.Contains(t, string(decoded), `"password":"***"`)
+}
+
+func Test_HARRecorder_BinaryRequestBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	recorder := NewHARRecorder(WithHARMaxBodySize(4))
+	client := NewHARClient(http.DefaultClient, recorder)
+	for _, body := range [][]byte{{0xff, 0xfe, 0x01}, {0xff, 0xfe, 0x01, 0x02, 0x03}} {
+		req, _ := http.NewRequest(http.MethodPost, backend.URL, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+
+	entries := recorder.HAR().Log.Entries
+	require.Len(t, entries, 2)
+	postData := entries[0].Request.PostData
+	require.Equal(t, "base64 encoded", postData.Comment)
+	require.Equal(t, base64.StdEncoding.EncodeToString([]byte{0xff, 0xfe, 0x01}), postData.Text)
+	postData = entries[1].Request.PostData
+	require.Equal(t, "body truncated, base64 encoded", postData.Comment)
+	require.Equal(t, base64.StdEncoding.EncodeToString([]byte{0xff, 0xfe, 0x01, 0x02}), postData.Text)
+}
+
+func Test_HARRecorder_WriteFileAndServeHTTP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	recorder := NewHARRecorder()
+	harGet(t, NewHARClient(http.DefaultClient, recorder), backend.URL)
+
+	filePath := filepath.Join(t.TempDir(), "out.har")
+	require.NoError(t, recorder.WriteFile(filePath))
+	data, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	fromFile := HAR{}
+	require.NoError(t, json.Unmarshal(data, &fromFile))
+	require.Len(t, fromFile.Log.Entries, 1)
+
+	w := httptest.NewRecorder()
+	recorder.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/har", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	fromHandler := HAR{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fromHandler))
+	require.Equal(t, fromFile, fromHandler)
+
+	w = httptest.NewRecorder()
+	recorder.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/debug/har", nil))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Len(t, recorder.HAR().Log.Entries, 0)
+}
@@ -0,0 +1,190 @@
+package requestclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+
+	"github.com/CodeNamor/Common/errors"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// DefaultMaxJSONBodySize is the largest response body the JSON helpers
+// will read unless changed with WithMaxBodySize
+const DefaultMaxJSONBodySize int64 = 10 << 20
+
+// maxErrorBodySnippet limits how much of an error response body is
+// kept in ErrorLog.AdditionalInformation
+const maxErrorBodySnippet = 512
+
+type jsonOptions struct {
+	maxBodySize           int64
+	disallowUnknownFields bool
+	headers               http.Header
+	source                string
+}
+
+// A JSONOption sets options for GetJSON, PostJSON and DoJSON
+type JSONOption func(*jsonOptions)
+
+// WithMaxBodySize is a JSONOption to limit the size of the response body
+func WithMaxBodySize(maxBytes int64) JSONOption {
+	return func(o *jsonOptions) {
+		o.maxBodySize = maxBytes
+	}
+}
+
+// WithDisallowUnknownFields is a JSONOption to fail decoding when the
+// response contains fields which are not in the response type
+func WithDisallowUnknownFields() JSONOption {
+	return func(o *jsonOptions) {
+		o.disallowUnknownFields = true
+	}
+}
+
+// WithJSONHeader is a JSONOption to set a header on the request
+func WithJSONHeader(key, value string) JSONOption {
+	return func(o *jsonOptions) {
+		o.headers.Set(key, value)
+	}
+}
+
+// WithSource is a JSONOption to set the ErrorLog.Source of any errors,
+// defaults to the host of the request url
+func WithSource(source string) JSONOption {
+	return func(o *jsonOptions) {
+		o.source = source
+	}
+}
+
+// GetJSON performs a GET of url and decodes the JSON response into T.
+// Any error returned is an *errors.ErrorLog.
+func GetJSON[T any](ctx context.Context, client RequestClient, url string, opts ...JSONOption) (T, error) {
+	return DoJSON[T](ctx, client, http.MethodGet, url, nil, opts...)
+}
+
+// PostJSON performs a POST of body encoded as JSON to url and decodes
+// the JSON response into Resp. Any error returned is an *errors.ErrorLog.
+func PostJSON[Req, Resp any](ctx context.Context, client RequestClient, url string, body Req, opts ...JSONOption) (Resp, error) {
+	return DoJSON[Resp](ctx, client, http.MethodPost, url, body, opts...)
+}
+
+// DoJSON performs a request with method to url, encoding body as JSON
+// unless it is nil, and decodes a JSON response into Resp. A non 2xx
+// status, or an empty body, leaves the Resp zero valued. Any error
+// returned is an *errors.ErrorLog with StatusCode, Source and Query
+// populated. When a non 2xx response body is an ErrorLog its Err is
+// a *RemoteError, see DecodeErrorResponse.
+func DoJSON[Resp any](ctx context.Context, client RequestClient, method string, url string, body interface{}, opts ...JSONOption) (Resp, error) {
+	var resp Resp
+	options := jsonOptions{
+		maxBodySize: DefaultMaxJSONBodySize,
+		headers:     http.Header{},
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	query, host := redactURL(url)
+	if options.source == "" {
+		options.source = host
+	}
+
+	var bodyReader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return resp, jsonErrorLog("unable to encode JSON request", pkgerrors.WithStack(err), query, &options)
+		}
+		bodyReader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	if err != nil {
+		var urlErr *neturl.Error
+		if pkgerrors.As(err, &urlErr) {
+			err = urlErr.Err // without the URL, which may hold a password
+		}
+		return resp, jsonErrorLog("unable to create request", pkgerrors.WithStack(err), query, &options)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range options.headers {
+		req.Header[k] = v
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return resp, jsonErrorLog("request failed", pkgerrors.WithStack(err), query, &options)
+	}
+	defer res.Body.Close()
+
+	rawBody, err := io.ReadAll(io.LimitReader(res.Body, options.maxBodySize+1))
+	if err != nil {
+		errorLog := jsonErrorLog("unable to read response", pkgerrors.WithStack(err), query, &options)
+		errorLog.StatusCode = strconv.Itoa(res.StatusCode)
+		return resp, errorLog
+	}
+	if int64(len(rawBody)) > options.maxBodySize {
+		errorLog := jsonErrorLog("response too large",
+			pkgerrors.Errorf("response body exceeds %d bytes", options.maxBodySize), query, &options)
+		errorLog.StatusCode = strconv.Itoa(res.StatusCode)
+		return resp, errorLog
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var statusErr error = pkgerrors.Errorf("%s %s returned status %v", method, query, res.Status)
+		if remote, ok := DecodeErrorResponse(res, rawBody, options.source); ok {
+			statusErr = remote
+		}
+		errorLog := jsonErrorLog("unexpected response status", statusErr, query, &options)
+		errorLog.StatusCode = strconv.Itoa(res.StatusCode)
+		errorLog.AdditionalInformation = bodySnippet(rawBody)
+		return resp, errorLog
+	}
+
+	if len(bytes.TrimSpace(rawBody)) == 0 {
+		return resp, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(rawBody))
+	if options.disallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&resp); err != nil {
+		errorLog := jsonErrorLog("unable to decode JSON response", pkgerrors.WithStack(err), query, &options)
+		errorLog.StatusCode = strconv.Itoa(res.StatusCode)
+		errorLog.AdditionalInformation = bodySnippet(rawBody)
+		return resp, errorLog
+	}
+	return resp, nil
+}
+
+// redactURL returns rawURL with any password redacted, or "" if it
+// can not be parsed, and its host
+func redactURL(rawURL string) (query string, host string) {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "", ""
+	}
+	return parsed.Redacted(), parsed.Host
+}
+
+func jsonErrorLog(rootCause string, err error, query string, options *jsonOptions) *errors.ErrorLog {
+	return &errors.ErrorLog{
+		RootCause: rootCause,
+		Source:    options.source,
+		Query:     query,
+		Err:       err,
+	}
+}
+
+func bodySnippet(body []byte) string {
+	if len(body) > maxErrorBodySnippet {
+		return string(body[:maxErrorBodySnippet]) + "..."
+	}
+	return string(body)
+}
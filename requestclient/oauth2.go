@@ -0,0 +1,298 @@
+package requestclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodeNamor/Common/logging"
+	"github.com/pkg/errors"
+)
+
+// DefaultTokenExpiryDelta is how long before its expiry a cached token
+// is considered expired and is refreshed
+const DefaultTokenExpiryDelta = 30 * time.Second
+
+// DefaultTokenRequestTimeout limits a request to the token endpoint,
+// which is not cancelled by any single caller as others may be waiting
+const DefaultTokenRequestTimeout = 30 * time.Second
+
+// maxTokenResponseSize limits how much of a token endpoint response is read
+const maxTokenResponseSize = 1 << 20
+
+// ClientCredentialsConfig configures an OAuth2 client-credentials
+// (RFC 6749 section 4.4) token source
+type ClientCredentialsConfig struct {
+	TokenURL       string
+	ClientID       string
+	ClientSecret   string
+	Scopes         []string
+	EndpointParams url.Values // additional form parameters such as audience
+	// AuthInParams sends the client id and secret as form parameters
+	// instead of using HTTP basic auth
+	AuthInParams bool
+	// ExpiryDelta is how early tokens are refreshed, defaults to DefaultTokenExpiryDelta
+	ExpiryDelta time.Duration
+	// RequestTimeout limits token requests, defaults to DefaultTokenRequestTimeout
+	RequestTimeout time.Duration
+	// HTTPClient is used to call the TokenURL, defaults to http.DefaultClient
+	HTTPClient RequestClient
+}
+
+// String implements the stringer interface without revealing the secret
+// so the config is safe to log
+func (c ClientCredentialsConfig) String() string {
+	return fmt.Sprintf("{TokenURL:%s ClientID:%s ClientSecret:[REDACTED] Scopes:%v}",
+		c.TokenURL, c.ClientID, c.Scopes)
+}
+
+// GoString implements the GoStringer interface so %#v does not reveal the secret
+func (c ClientCredentialsConfig) GoString() string {
+	return "requestclient.ClientCredentialsConfig" + c.String()
+}
+
+// Token is an OAuth2 access token
+type Token struct {
+	AccessToken string
+	TokenType   string
+	Expiry      time.Time // zero if the token endpoint did not provide expires_in
+}
+
+// tokenCall is an in-flight token request which concurrent callers wait on
+type tokenCall struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// TokenSource fetches tokens using the client-credentials flow and
+// caches them until shortly before they expire. It is safe for
+// concurrent use, concurrent callers needing a new token share a
+// single request to the token endpoint.
+type TokenSource struct {
+	config ClientCredentialsConfig
+	now    func() time.Time
+
+	mu       sync.Mutex
+	token    *Token
+	inflight *tokenCall
+}
+
+// NewClientCredentialsTokenSource creates a TokenSource from config
+func NewClientCredentialsTokenSource(config ClientCredentialsConfig) *TokenSource {
+	if config.ExpiryDelta == 0 {
+		config.ExpiryDelta = DefaultTokenExpiryDelta
+	}
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = DefaultTokenRequestTimeout
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &TokenSource{
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// Token returns the cached token if it is still valid, otherwise it
+// fetches a new one from the token endpoint. The fetch is shared by
+// concurrent callers so it is not cancelled by ctx, which only ends
+// this caller's wait.
+func (ts *TokenSource) Token(ctx context.Context) (*Token, error) {
+	ts.mu.Lock()
+	if ts.token != nil && ts.valid(ts.token) {
+		token := ts.token
+		ts.mu.Unlock()
+		return token, nil
+	}
+	call := ts.inflight
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		ts.inflight = call
+		go ts.fetch(call)
+	}
+	ts.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Invalidate drops the cached token if it is still stale, so the
+// next call to Token fetches a new one. Passing the token that was
+// rejected prevents discarding a newer token another caller fetched.
+func (ts *TokenSource) Invalidate(stale *Token) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if stale == nil || ts.token == stale {
+		ts.token = nil
+	}
+}
+
+func (ts *TokenSource) valid(token *Token) bool {
+	return token.Expiry.IsZero() || ts.now().Add(ts.config.ExpiryDelta).Before(token.Expiry)
+}
+
+// fetch requests a token for call on a context of its own, so a
+// cancelled caller does not fail the others waiting on call
+func (ts *TokenSource) fetch(call *tokenCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), ts.config.RequestTimeout)
+	defer cancel()
+	call.token, call.err = ts.requestToken(ctx)
+
+	ts.mu.Lock()
+	if call.err == nil {
+		ts.token = call.token
+	}
+	ts.inflight = nil
+	ts.mu.Unlock()
+	close(call.done)
+}
+
+type tokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	TokenType        string      `json:"token_type"`
+	ExpiresIn        json.Number `json:"expires_in"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+func (ts *TokenSource) requestToken(ctx context.Context) (*Token, error) {
+	form := url.Values{}
+	for k, v := range ts.config.EndpointParams {
+		form[k] = append([]string{}, v...)
+	}
+	form.Set("grant_type", "client_credentials")
+	if len(ts.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(ts.config.Scopes, " "))
+	}
+	if ts.config.AuthInParams {
+		form.Set("client_id", ts.config.ClientID)
+		form.Set("client_secret", ts.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create oauth2 token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !ts.config.AuthInParams {
+		req.SetBasicAuth(url.QueryEscape(ts.config.ClientID), url.QueryEscape(ts.config.ClientSecret))
+	}
+
+	requestTime := ts.now()
+	res, err := ts.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "oauth2 token request failed url: %s", ts.config.TokenURL)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxTokenResponseSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read oauth2 token response url: %s", ts.config.TokenURL)
+	}
+
+	tokenRes := tokenResponse{}
+	decodeErr := json.Unmarshal(body, &tokenRes)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		if decodeErr == nil && tokenRes.Error != "" {
+			return nil, errors.Errorf("oauth2 token request returned status %v: %s %s url: %s",
+				res.Status, tokenRes.Error, tokenRes.ErrorDescription, ts.config.TokenURL)
+		}
+		return nil, errors.Errorf("oauth2 token request returned status %v url: %s", res.Status, ts.config.TokenURL)
+	}
+	if decodeErr != nil {
+		return nil, errors.Wrapf(decodeErr, "unable to decode oauth2 token response url: %s", ts.config.TokenURL)
+	}
+	if tokenRes.AccessToken == "" {
+		return nil, errors.Errorf("oauth2 token response missing access_token url: %s", ts.config.TokenURL)
+	}
+
+	token := &Token{
+		AccessToken: tokenRes.AccessToken,
+		TokenType:   tokenRes.TokenType,
+	}
+	if tokenRes.ExpiresIn != "" {
+		expiresIn, err := tokenRes.ExpiresIn.Int64()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid oauth2 expires_in url: %s", ts.config.TokenURL)
+		}
+		if expiresIn > 0 {
+			token.Expiry = requestTime.Add(time.Duration(expiresIn) * time.Second)
+		}
+	}
+	logging.Trace("oauth2 token fetched for client ", ts.config.ClientID, " expiry ", token.Expiry)
+	return token, nil
+}
+
+// OAuth2Client is a RequestClient which adds a bearer token from a
+// TokenSource to each request. If the server responds with 401
+// Unauthorized the token is invalidated and the request is retried
+// once with a fresh token.
+type OAuth2Client struct {
+	next   RequestClient
+	source *TokenSource
+}
+
+// NewOAuth2Client wraps next in an OAuth2Client using tokens from source
+func NewOAuth2Client(next RequestClient, source *TokenSource) *OAuth2Client {
+	return &OAuth2Client{
+		next:   next,
+		source: source,
+	}
+}
+
+// Do adds the Authorization header and calls the wrapped RequestClient.
+// A request with a body is only retried if req.GetBody is set, which
+// http.NewRequest does for the common body types.
+func (c *OAuth2Client) Do(req *http.Request) (*http.Response, error) {
+	token, err := c.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.next.Do(authorizedRequest(req, token))
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return res, nil // unable to replay the body
+	}
+
+	// drain so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, maxTokenResponseSize))
+	res.Body.Close()
+
+	logging.Trace("oauth2 request unauthorized, retrying with a new token url: ", req.URL.Redacted())
+	c.source.Invalidate(token)
+	token, err = c.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	retry := authorizedRequest(req, token)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, errors.Wrap(err, "unable to replay request body")
+		}
+	}
+	return c.next.Do(retry)
+}
+
+func authorizedRequest(req *http.Request, token *Token) *http.Request {
+	authorized := req.Clone(req.Context())
+	tokenType := token.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	authorized.Header.Set("Authorization", tokenType+" "+token.AccessToken)
+	return authorized
+}
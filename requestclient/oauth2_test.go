@@ -0,0 +1,199 @@
+package requestclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTokenServer starts a token endpoint which issues "token-<n>" and
+// counts the number of tokens issued
+func newTokenServer(t *testing.T, expiresIn int, issued *int32) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "myclient" || pass != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("scope") != "read write" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_request"}`))
+			return
+		}
+		time.Sleep(10 * time.Millisecond) // give concurrent callers time to pile up
+		n := atomic.AddInt32(issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, n, expiresIn)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func newTestTokenSource(tokenURL string) *TokenSource {
+	return NewClientCredentialsTokenSource(ClientCredentialsConfig{
+		TokenURL:     tokenURL,
+		ClientID:     "myclient",
+		ClientSecret: "s3cret",
+		Scopes:       []string{"read", "write"},
+	})
+}
+
+func Test_TokenSource_CachesUntilExpiry(t *testing.T) {
+	var issued int32
+	tokenServer := newTokenServer(t, 3600, &issued)
+	source := newTestTokenSource(tokenServer.URL)
+	now := time.Now()
+	source.now = func() time.Time { return now }
+
+	token, err := source.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "token-1", token.AccessToken)
+
+	token, err = source.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "token-1", token.AccessToken)
+
+	// within the expiry delta the token is refreshed
+	now = now.Add(3600*time.Second - DefaultTokenExpiryDelta)
+	token, err = source.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "token-2", token.AccessToken)
+	require.Equal(t, int32(2), atomic.LoadInt32(&issued))
+}
+
+func Test_TokenSource_SingleFlight(t *testing.T) {
+	var issued int32
+	tokenServer := newTokenServer(t, 3600, &issued)
+	source := newTestTokenSource(tokenServer.URL)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := source.Token(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, "token-1", token.AccessToken)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&issued))
+}
+
+func Test_TokenSource_CancelledCallerDoesNotFailOthers(t *testing.T) {
+	release := make(chan struct{})
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"token-1","token_type":"bearer","expires_in":3600}`))
+	}))
+	t.Cleanup(tokenServer.Close)
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+	})
+	source := newTestTokenSource(tokenServer.URL)
+
+	// caller A starts the fetch then gives up
+	ctxA, cancelA := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelA()
+	errA := make(chan error, 1)
+	go func() {
+		_, err := source.Token(ctxA)
+		errA <- err
+	}()
+	require.Eventually(t, func() bool {
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		return source.inflight != nil
+	}, time.Second, time.Millisecond)
+
+	// caller B waits on the same fetch
+	type result struct {
+		token *Token
+		err   error
+	}
+	resultB := make(chan result, 1)
+	go func() {
+		token, err := source.Token(context.Background())
+		resultB <- result{token, err}
+	}()
+
+	require.ErrorIs(t, <-errA, context.DeadlineExceeded)
+	close(release)
+	b := <-resultB
+	require.NoError(t, b.err)
+	require.Equal(t, "token-1", b.token.AccessToken)
+}
+
+func Test_TokenSource_ErrorDoesNotRevealSecret(t *testing.T) {
+	var issued int32
+	tokenServer := newTokenServer(t, 3600, &issued)
+	source := NewClientCredentialsTokenSource(ClientCredentialsConfig{
+		TokenURL:     tokenServer.URL,
+		ClientID:     "myclient",
+		ClientSecret: "wrong-s3cret",
+	})
+
+	_, err := source.Token(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid_client")
+	require.NotContains(t, fmt.Sprintf("%+v", err), "wrong-s3cret")
+	require.NotContains(t, fmt.Sprintf("%v %+v %#v", source.config, source.config, source.config), "wrong-s3cret")
+}
+
+func Test_OAuth2Client_RetriesOnceOn401(t *testing.T) {
+	var issued int32
+	tokenServer := newTokenServer(t, 3600, &issued)
+
+	var calls int32
+	var bodies []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		// the first token has been revoked by the server
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer api.Close()
+
+	client := NewOAuth2Client(http.DefaultClient, newTestTokenSource(tokenServer.URL))
+	req, _ := http.NewRequest(http.MethodPost, api.URL, strings.NewReader("payload"))
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	require.Equal(t, []string{"payload", "payload"}, bodies)
+
+	// a persistent 401 is only retried once
+	api.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	atomic.StoreInt32(&calls, 0)
+	req, _ = http.NewRequest(http.MethodGet, api.URL, nil)
+	res, err = client.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,200 @@
+package requestclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/ascarter/requestid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultRequestIDHeader is the header the request ID is forwarded in
+	// unless another one is configured with WithRequestIDHeader
+	DefaultRequestIDHeader = "X-Request-ID"
+	// TraceParentHeader is the W3C trace context traceparent header
+	TraceParentHeader = "traceparent"
+	// TraceStateHeader is the W3C trace context tracestate header
+	TraceStateHeader = "tracestate"
+)
+
+// TraceContext holds the W3C trace context (https://www.w3.org/TR/trace-context/)
+// values for a request.
+type TraceContext struct {
+	TraceID  [16]byte
+	ParentID [8]byte
+	Flags    byte
+	State    string // raw tracestate header value, forwarded as is
+}
+
+type traceContextKey struct{}
+
+// NewTraceContext generates a new sampled TraceContext with random
+// trace and parent ids
+func NewTraceContext() TraceContext {
+	tc := TraceContext{Flags: 0x01}
+	randomBytes(tc.TraceID[:])
+	randomBytes(tc.ParentID[:])
+	return tc
+}
+
+// ParseTraceParent parses a traceparent header value of the form
+// 00-<32 hex trace-id>-<16 hex parent-id>-<2 hex flags>
+func ParseTraceParent(traceParent string) (TraceContext, error) {
+	tc := TraceContext{}
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return tc, errors.Errorf("invalid traceparent: %q", traceParent)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return tc, errors.Errorf("invalid traceparent: %q", traceParent)
+	}
+	if err := decodeHexInto(tc.TraceID[:], parts[1]); err != nil || isZero(tc.TraceID[:]) {
+		return tc, errors.Errorf("invalid traceparent trace-id: %q", traceParent)
+	}
+	if err := decodeHexInto(tc.ParentID[:], parts[2]); err != nil || isZero(tc.ParentID[:]) {
+		return tc, errors.Errorf("invalid traceparent parent-id: %q", traceParent)
+	}
+	flags := [1]byte{}
+	if err := decodeHexInto(flags[:], parts[3]); err != nil {
+		return tc, errors.Errorf("invalid traceparent flags: %q", traceParent)
+	}
+	tc.Flags = flags[0]
+	return tc, nil
+}
+
+// TraceParent formats the TraceContext as a version 00 traceparent header value
+func (tc TraceContext) TraceParent() string {
+	return "00-" + hex.EncodeToString(tc.TraceID[:]) + "-" +
+		hex.EncodeToString(tc.ParentID[:]) + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+// TraceIDString returns the hex encoded trace id
+func (tc TraceContext) TraceIDString() string {
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+// Child returns a TraceContext in the same trace with a new parent id,
+// which is what is sent on an outbound call
+func (tc TraceContext) Child() TraceContext {
+	child := tc
+	randomBytes(child.ParentID[:])
+	return child
+}
+
+// ContextWithTraceContext returns a copy of ctx carrying tc, outbound
+// calls made with the returned context will continue its trace
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceContextFromContext returns the TraceContext stored in ctx
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+type propagationOptions struct {
+	requestIDHeader string
+	traceContext    bool
+}
+
+// A PropagationOption sets options for the PropagatingClient
+type PropagationOption func(*propagationOptions)
+
+// WithRequestIDHeader is a PropagationOption to set the header the
+// request ID is forwarded in, defaults to DefaultRequestIDHeader
+func WithRequestIDHeader(header string) PropagationOption {
+	return func(o *propagationOptions) {
+		o.requestIDHeader = header
+	}
+}
+
+// WithoutTraceContext is a PropagationOption that disables forwarding
+// and generating the traceparent and tracestate headers
+func WithoutTraceContext() PropagationOption {
+	return func(o *propagationOptions) {
+		o.traceContext = false
+	}
+}
+
+// PropagatingClient is a RequestClient which copies the request ID
+// (github.com/ascarter/requestid) from req.Context() into a header and
+// forwards the W3C traceparent and tracestate headers before calling
+// the wrapped RequestClient
+type PropagatingClient struct {
+	next RequestClient
+	opts propagationOptions
+}
+
+// NewPropagatingClient wraps next in a PropagatingClient
+func NewPropagatingClient(next RequestClient, opt ...PropagationOption) *PropagatingClient {
+	opts := propagationOptions{
+		requestIDHeader: DefaultRequestIDHeader,
+		traceContext:    true,
+	}
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &PropagatingClient{
+		next: next,
+		opts: opts,
+	}
+}
+
+// Do adds the propagation headers and calls the wrapped RequestClient.
+// Headers already present on req are left untouched. The request is
+// cloned before being modified as a RequestClient must not modify req.
+func (c *PropagatingClient) Do(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	ctx := req.Context()
+
+	if c.opts.requestIDHeader != "" && req.Header.Get(c.opts.requestIDHeader) == "" {
+		if requestID, ok := requestid.FromContext(ctx); ok && requestID != "" {
+			req.Header.Set(c.opts.requestIDHeader, requestID)
+		}
+	}
+
+	if c.opts.traceContext && req.Header.Get(TraceParentHeader) == "" {
+		tc, ok := TraceContextFromContext(ctx)
+		if ok {
+			tc = tc.Child()
+		} else {
+			tc = NewTraceContext()
+		}
+		req.Header.Set(TraceParentHeader, tc.TraceParent())
+		if tc.State != "" && req.Header.Get(TraceStateHeader) == "" {
+			req.Header.Set(TraceStateHeader, tc.State)
+		}
+	}
+
+	return c.next.Do(req)
+}
+
+func decodeHexInto(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return errors.New("invalid hex length or case")
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// randomBytes fills b from crypto/rand, it only fails if the
+// system random source is unavailable
+func randomBytes(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(errors.Wrap(err, "unable to read random bytes"))
+	}
+}
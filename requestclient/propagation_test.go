@@ -0,0 +1,108 @@
+package requestclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ascarter/requestid"
+	"github.com/stretchr/testify/require"
+)
+
+// captureClient records the last request it was asked to send
+type captureClient struct {
+	req *http.Request
+}
+
+func (c *captureClient) Do(req *http.Request) (*http.Response, error) {
+	c.req = req
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func Test_ParseTraceParent(t *testing.T) {
+	testcases := []struct {
+		name        string
+		traceParent string
+		expectErr   bool
+	}{
+		{name: "valid", traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "future version with extra fields", traceParent: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{name: "empty", traceParent: "", expectErr: true},
+		{name: "version ff", traceParent: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", expectErr: true},
+		{name: "zero trace id", traceParent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", expectErr: true},
+		{name: "zero parent id", traceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", expectErr: true},
+		{name: "uppercase", traceParent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", expectErr: true},
+		{name: "short trace id", traceParent: "00-4bf92f35-00f067aa0ba902b7-01", expectErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			parsed, err := ParseTraceParent(tc.traceParent)
+			if tc.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", parsed.TraceIDString())
+			require.Equal(t, byte(0x01), parsed.Flags)
+		})
+	}
+}
+
+func Test_PropagatingClient_Do(t *testing.T) {
+	parent, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	parent.State = "vendor=abc"
+
+	t.Run("forwards request id and continues trace from context", func(t *testing.T) {
+		capture := &captureClient{}
+		ctx := requestid.NewContext(context.Background(), "rid-1")
+		ctx = ContextWithTraceContext(ctx, parent)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+
+		_, err := NewPropagatingClient(capture).Do(req)
+		require.NoError(t, err)
+		require.Equal(t, "rid-1", capture.req.Header.Get(DefaultRequestIDHeader))
+		sent, err := ParseTraceParent(capture.req.Header.Get(TraceParentHeader))
+		require.NoError(t, err)
+		require.Equal(t, parent.TraceID, sent.TraceID)
+		require.NotEqual(t, parent.ParentID, sent.ParentID)
+		require.Equal(t, "vendor=abc", capture.req.Header.Get(TraceStateHeader))
+		require.Empty(t, req.Header.Get(TraceParentHeader), "original request must not be modified")
+	})
+
+	t.Run("generates traceparent and uses configured header", func(t *testing.T) {
+		capture := &captureClient{}
+		ctx := requestid.NewContext(context.Background(), "rid-2")
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+
+		_, err := NewPropagatingClient(capture, WithRequestIDHeader("X-Correlation-ID")).Do(req)
+		require.NoError(t, err)
+		require.Equal(t, "rid-2", capture.req.Header.Get("X-Correlation-ID"))
+		require.Empty(t, capture.req.Header.Get(DefaultRequestIDHeader))
+		_, err = ParseTraceParent(capture.req.Header.Get(TraceParentHeader))
+		require.NoError(t, err)
+	})
+
+	t.Run("leaves existing headers alone", func(t *testing.T) {
+		capture := &captureClient{}
+		ctx := requestid.NewContext(context.Background(), "rid-3")
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+		req.Header.Set(DefaultRequestIDHeader, "explicit")
+		req.Header.Set(TraceParentHeader, parent.TraceParent())
+
+		_, err := NewPropagatingClient(capture).Do(req)
+		require.NoError(t, err)
+		require.Equal(t, "explicit", capture.req.Header.Get(DefaultRequestIDHeader))
+		require.Equal(t, parent.TraceParent(), capture.req.Header.Get(TraceParentHeader))
+	})
+
+	t.Run("without trace context", func(t *testing.T) {
+		capture := &captureClient{}
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+		_, err := NewPropagatingClient(capture, WithoutTraceContext()).Do(req)
+		require.NoError(t, err)
+		require.Empty(t, capture.req.Header.Get(TraceParentHeader))
+		require.Empty(t, capture.req.Header.Get(DefaultRequestIDHeader))
+	})
+}
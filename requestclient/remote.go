@@ -0,0 +1,65 @@
+package requestclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/CodeNamor/Common/errors"
+)
+
+// RemoteError is an errors.ErrorLog returned in the error response of
+// another service, such as one written by server.WriteError. DoJSON
+// wraps it in a local ErrorLog, use errors.As to tell a remote failure
+// from a local one.
+type RemoteError struct {
+	ErrorLog   *errors.ErrorLog // as returned, Source is the remote service
+	StatusCode int              // status of the response
+	RequestID  string           // RequestId of the remote request, if returned
+}
+
+func (e *RemoteError) Error() string {
+	return "remote error: " + e.ErrorLog.Error()
+}
+
+// Unwrap returns the remote ErrorLog, so its Code is found by
+// errors.CodeOf and errors.IsRetryable
+func (e *RemoteError) Unwrap() error {
+	return e.ErrorLog
+}
+
+// DecodeErrorResponse decodes the body of a non 2xx response res which
+// is errors.ErrorLog JSON into a RemoteError. source is the Source when
+// the body has none. It returns false when the body is not an ErrorLog.
+func DecodeErrorResponse(res *http.Response, body []byte, source string) (*RemoteError, bool) {
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return nil, false
+	}
+	contentType := res.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "json") {
+		return nil, false
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '{' {
+		return nil, false
+	}
+
+	errorLog := &errors.ErrorLog{}
+	if err := json.Unmarshal(body, errorLog); err != nil {
+		return nil, false
+	}
+	if errorLog.RootCause == "" && errorLog.Trace == "" && errorLog.StatusCode == "" &&
+		errorLog.ExceptionType == "" && errorLog.Code == "" {
+		return nil, false // some other JSON object
+	}
+	if errorLog.Source == "" {
+		errorLog.Source = source
+	}
+
+	requestID := struct {
+		RequestID string `json:"RequestId"`
+	}{}
+	json.Unmarshal(body, &requestID)
+	return &RemoteError{ErrorLog: errorLog, StatusCode: res.StatusCode, RequestID: requestID.RequestID}, true
+}
@@ -0,0 +1,77 @@
+package requestclient
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/CodeNamor/Common/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DecodeErrorResponse(t *testing.T) {
+	testcases := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		ok          bool
+		expected    *RemoteError
+	}{
+		{
+			name:        "ErrorLog",
+			status:      http.StatusServiceUnavailable,
+			contentType: "application/json",
+			body:        `{"Trace":"refused","RootCause":"pricing down","StatusCode":"503","Source":"pricing","Code":"Unavailable","RequestId":"rid-9"}`,
+			ok:          true,
+			expected: &RemoteError{
+				ErrorLog: &errors.ErrorLog{
+					RootCause:  "pricing down",
+					Trace:      "refused",
+					StatusCode: "503",
+					Source:     "pricing",
+					Code:       errors.CodeUnavailable,
+				},
+				StatusCode: http.StatusServiceUnavailable,
+				RequestID:  "rid-9",
+			},
+		},
+		{
+			name:   "no Source or content type",
+			status: http.StatusBadRequest,
+			body:   `{"RootCause":"invalid request","ExceptionType":"ValidationError"}`,
+			ok:     true,
+			expected: &RemoteError{
+				ErrorLog:   &errors.ErrorLog{RootCause: "invalid request", ExceptionType: "ValidationError", Source: "widgets.local"},
+				StatusCode: http.StatusBadRequest,
+			},
+		},
+		{name: "success status", status: http.StatusOK, body: `{"RootCause":"odd"}`},
+		{name: "not JSON", status: http.StatusNotFound, contentType: "text/plain", body: `{"RootCause":"odd"}`},
+		{name: "plain text", status: http.StatusNotFound, body: `not found`},
+		{name: "other JSON", status: http.StatusNotFound, contentType: "application/json", body: `{"message":"not found"}`},
+		{name: "array", status: http.StatusBadGateway, contentType: "application/json", body: `[{"RootCause":"odd"}]`},
+		{name: "malformed", status: http.StatusBadGateway, contentType: "application/json", body: `{"RootCause":`},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: tc.status, Header: http.Header{}}
+			if tc.contentType != "" {
+				res.Header.Set("Content-Type", tc.contentType)
+			}
+			remote, ok := DecodeErrorResponse(res, []byte(tc.body), "widgets.local")
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.expected, remote)
+		})
+	}
+}
+
+func Test_RemoteError(t *testing.T) {
+	remote := &RemoteError{
+		ErrorLog:   errors.NewCode(errors.CodeTimeout, "slow"),
+		StatusCode: http.StatusGatewayTimeout,
+	}
+	remote.ErrorLog.Source = "stock"
+	require.Equal(t, "remote error: slow Code:Timeout Source:stock", remote.Error())
+	require.True(t, errors.IsRetryable(remote))
+	require.True(t, errors.Is(remote, &errors.ErrorLog{Code: errors.CodeTimeout}))
+}
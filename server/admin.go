@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/CodeNamor/Common/logging"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// processStart is used to report the uptime
+var processStart = time.Now()
+
+// maxGCPauses is how many of the most recent GC pauses are reported
+const maxGCPauses = 10
+
+// RuntimeStats is the JSON body of the admin /debug/runtime endpoint
+type RuntimeStats struct {
+	Uptime        string    `json:"uptime"`
+	GoVersion     string    `json:"goVersion"`
+	NumCPU        int       `json:"numCPU"`
+	GOMAXPROCS    int       `json:"gomaxprocs"`
+	NumGoroutine  int       `json:"numGoroutine"`
+	HeapAlloc     uint64    `json:"heapAlloc"`
+	HeapInuse     uint64    `json:"heapInuse"`
+	HeapObjects   uint64    `json:"heapObjects"`
+	Sys           uint64    `json:"sys"`
+	NumGC         uint32    `json:"numGC"`
+	PauseTotalNs  uint64    `json:"pauseTotalNs"`
+	RecentPauseNs []uint64  `json:"recentPauseNs"` // most recent first
+	LastGC        time.Time `json:"lastGC"`
+	PanicCount    uint64    `json:"panicCount"`
+	RateLimited   uint64    `json:"rateLimited"`
+	LoadShed      uint64    `json:"loadShed"`
+}
+
+// LogLevel is the JSON body of the admin /debug/loglevel endpoint
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+type adminOptions struct {
+	handlers map[string]http.Handler
+}
+
+// A AdminOption sets options for NewAdminHandler
+type AdminOption func(*adminOptions)
+
+// WithAdminHandler is an AdminOption to mount another handler on the
+// admin listener at path, such as a requestclient.FaultClient AdminHandler
+// or a requestclient.HARRecorder
+func WithAdminHandler(path string, handler http.Handler) AdminOption {
+	return func(o *adminOptions) {
+		o.handlers[path] = handler
+	}
+}
+
+// NewAdminHandler creates the handler for an internal only admin listener:
+//
+//	/debug/pprof/     net/http/pprof profiles
+//	/debug/runtime    goroutine, heap and GC statistics
+//	/debug/buildinfo  build info from debug.ReadBuildInfo
+//	/debug/loglevel   GET the logging level, PUT {"level":"trace"} to change it
+func NewAdminHandler(opt ...AdminOption) *mux.Router {
+	opts := adminOptions{handlers: map[string]http.Handler{}}
+	for _, o := range opt {
+		o(&opts)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	router.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index) // named profiles such as heap and goroutine
+	router.HandleFunc("/debug/runtime", DefaultHandler(runtimeStatsHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/debug/buildinfo", DefaultHandler(buildInfoHandler)).Methods(http.MethodGet)
+	router.HandleFunc("/debug/loglevel", DefaultHandler(logLevelHandler)).Methods(http.MethodGet, http.MethodPut, http.MethodPost)
+	for path, handler := range opts.handlers {
+		router.Handle(path, handler)
+	}
+	return router
+}
+
+// ReadRuntimeStats collects the current RuntimeStats
+func ReadRuntimeStats() RuntimeStats {
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+
+	pauses := []uint64{}
+	for i := uint32(0); i < memStats.NumGC && i < maxGCPauses; i++ {
+		pauses = append(pauses, memStats.PauseNs[(memStats.NumGC-1-i+256)%256])
+	}
+	lastGC := time.Time{}
+	if memStats.LastGC > 0 {
+		lastGC = time.Unix(0, int64(memStats.LastGC))
+	}
+
+	return RuntimeStats{
+		Uptime:        time.Since(processStart).Round(time.Second).String(),
+		GoVersion:     runtime.Version(),
+		NumCPU:        runtime.NumCPU(),
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		NumGoroutine:  runtime.NumGoroutine(),
+		HeapAlloc:     memStats.HeapAlloc,
+		HeapInuse:     memStats.HeapInuse,
+		HeapObjects:   memStats.HeapObjects,
+		Sys:           memStats.Sys,
+		NumGC:         memStats.NumGC,
+		PauseTotalNs:  memStats.PauseTotalNs,
+		RecentPauseNs: pauses,
+		LastGC:        lastGC,
+		PanicCount:    PanicCount(),
+		RateLimited:   RateLimitedCount(),
+		LoadShed:      LoadShedCount(),
+	}
+}
+
+func runtimeStatsHandler(w http.ResponseWriter, _ *http.Request) {
+	json.NewEncoder(w).Encode(ReadRuntimeStats())
+}
+
+func buildInfoHandler(w http.ResponseWriter, _ *http.Request) {
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		http.Error(w, `{"error":"build info not available"}`, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(buildInfo)
+}
+
+func logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		requested := LogLevel{Level: r.URL.Query().Get("level")}
+		if requested.Level == "" {
+			if err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&requested); err != nil {
+				writeLogLevelError(w, "invalid body, expected {\"level\":\"trace|info|warn|error\"}")
+				return
+			}
+		}
+		previous := logging.GetLevel()
+		if err := logging.SetLevelFromString(strings.ToLower(strings.TrimSpace(requested.Level))); err != nil {
+			writeLogLevelError(w, err.Error())
+			return
+		}
+		// logged at warning so the change is visible at the common levels
+		logging.Warning("logging level changed from ", previous, " to ", logging.GetLevel())
+	}
+	json.NewEncoder(w).Encode(LogLevel{Level: logging.GetLevel().String()})
+}
+
+func writeLogLevelError(w http.ResponseWriter, msg string) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// startAdminServer listens on the admin address and serves the admin
+// handler in the background, serve errors are logged
+func startAdminServer(opts *options) (*http.Server, error) {
+	ln, err := net.Listen("tcp", opts.adminAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to listen on admin address")
+	}
+	adminSrv := &http.Server{
+		Addr:              opts.adminAddr,
+		Handler:           opts.adminHandler,
+		ReadHeaderTimeout: opts.readHeaderTimeout,
+		IdleTimeout:       opts.idleTimeout,
+		MaxHeaderBytes:    opts.maxHeaderBytes,
+	}
+	logging.Info("HTTP admin server address " + ln.Addr().String())
+	go func() {
+		if err := adminSrv.Serve(ln); !isNormalShutdown(err) {
+			logging.Error("admin server failed: ", err)
+		}
+	}()
+	return adminSrv, nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CodeNamor/Common/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewAdminHandler(t *testing.T) {
+	captureLogs(t)
+	handler := NewAdminHandler(WithAdminHandler("/debug/faults", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("faults"))
+	})))
+
+	serve := func(method string, target string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	t.Run("pprof", func(t *testing.T) {
+		w := serve(http.MethodGet, "/debug/pprof/", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Body.String(), "goroutine")
+
+		w = serve(http.MethodGet, "/debug/pprof/heap?debug=1", "")
+		require.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("runtime", func(t *testing.T) {
+		w := serve(http.MethodGet, "/debug/runtime", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		stats := RuntimeStats{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+		require.Greater(t, stats.NumGoroutine, 0)
+		require.Greater(t, stats.HeapAlloc, uint64(0))
+	})
+
+	t.Run("buildinfo", func(t *testing.T) {
+		w := serve(http.MethodGet, "/debug/buildinfo", "")
+		require.Contains(t, []int{http.StatusOK, http.StatusNotFound}, w.Code)
+	})
+
+	t.Run("loglevel", func(t *testing.T) {
+		w := serve(http.MethodGet, "/debug/loglevel", "")
+		require.JSONEq(t, `{"level":"info"}`, w.Body.String())
+
+		w = serve(http.MethodPut, "/debug/loglevel", `{"level":"trace"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.JSONEq(t, `{"level":"trace"}`, w.Body.String())
+		require.Equal(t, logging.TraceLevel, logging.GetLevel())
+
+		w = serve(http.MethodPost, "/debug/loglevel?level=warn", "")
+		require.JSONEq(t, `{"level":"warn"}`, w.Body.String())
+
+		w = serve(http.MethodPut, "/debug/loglevel", `{"level":"loud"}`)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Equal(t, logging.WarningLevel, logging.GetLevel())
+	})
+
+	t.Run("mounted handler", func(t *testing.T) {
+		w := serve(http.MethodGet, "/debug/faults", "")
+		require.Equal(t, "faults", w.Body.String())
+	})
+}
+
+func Test_Serve_AdminListener(t *testing.T) {
+	adminLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	adminAddr := adminLn.Addr().String()
+	require.NoError(t, adminLn.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	url, result := startServe(t, ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("main"))
+	}), WithAdminListener(adminAddr, NewAdminHandler()))
+
+	require.Equal(t, "main", getBody(t, url))
+	require.Contains(t, getBody(t, "http://"+adminAddr+"/debug/runtime"), "numGoroutine")
+
+	cancel()
+	select {
+	case err := <-result:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+	_, err = http.Get("http://" + adminAddr + "/debug/runtime")
+	require.Error(t, err, "admin listener is shut down with the server")
+}
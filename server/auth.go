@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/CodeNamor/Common/errors"
+	"github.com/gorilla/mux"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// DefaultAPIKeyHeader is the header read by the APIKeyAuthenticator
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// Authentication methods set on Principal.Method
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "apikey"
+	AuthMethodBasic  = "basic"
+)
+
+// Errors returned by Authenticators
+var (
+	// ErrNoCredentials is returned when the request does not carry the
+	// credentials of the Authenticator, so the next one is tried
+	ErrNoCredentials = pkgerrors.New("no credentials")
+	// ErrInvalidCredentials is returned when the credentials are not valid
+	ErrInvalidCredentials = pkgerrors.New("invalid credentials")
+)
+
+// Principal is the authenticated caller stored in the request context
+type Principal struct {
+	Subject string
+	Method  string                 // one of the AuthMethod values
+	Scopes  []string               // from the JWT scope claim or configured for the key or user
+	Claims  map[string]interface{} // JWT claims, nil for other methods
+}
+
+// HasScope reports whether the principal was granted scope
+func (p *Principal) HasScope(scope string) bool {
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalContextKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying principal
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext returns the Principal stored by AuthMiddleware
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// Authenticator authenticates a request. Authenticate returns
+// ErrNoCredentials if the request does not carry its kind of
+// credentials. Challenge is the WWW-Authenticate value, such as
+// `Bearer realm="api"`, or empty for none.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+	Challenge() string
+}
+
+// AuthMiddleware authenticates each request with the first of the
+// authenticators whose credentials are present, storing the Principal
+// in the request context. Requests without credentials or with invalid
+// ones get 401 Unauthorized with an errors.ErrorLog JSON body.
+func AuthMiddleware(authenticators ...Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := error(ErrNoCredentials)
+			for _, authenticator := range authenticators {
+				principal, authErr := authenticator.Authenticate(r)
+				if authErr == nil {
+					next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
+					return
+				}
+				if pkgerrors.Cause(authErr) != ErrNoCredentials {
+					err = authErr
+					break
+				}
+			}
+
+			for _, authenticator := range authenticators {
+				if challenge := authenticator.Challenge(); challenge != "" {
+					w.Header().Add("WWW-Authenticate", challenge)
+				}
+			}
+			WriteError(w, r, &errors.ErrorLog{
+				RootCause:     "unauthorized",
+				StatusCode:    "401",
+				ExceptionType: "Unauthorized",
+				Err:           err,
+			})
+		})
+	}
+}
+
+// RequireScopes returns middleware, used after AuthMiddleware, which
+// responds 403 Forbidden with an errors.ErrorLog JSON body unless the
+// principal has all of the scopes
+func RequireScopes(scopes ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFromContext(r.Context())
+			if !ok {
+				WriteError(w, r, &errors.ErrorLog{
+					RootCause:     "unauthorized",
+					StatusCode:    "401",
+					ExceptionType: "Unauthorized",
+					Err:           ErrNoCredentials,
+				})
+				return
+			}
+			for _, scope := range scopes {
+				if !principal.HasScope(scope) {
+					WriteError(w, r, &errors.ErrorLog{
+						RootCause:     "forbidden",
+						StatusCode:    "403",
+						ExceptionType: "Forbidden",
+						Err:           pkgerrors.Errorf("missing scope %s", scope),
+					})
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HashAPIKey returns the hex SHA-256 hash of key as stored in an
+// APIKeyStore, so plaintext keys do not need to be kept
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyStore looks up the Principal of an API key by its HashAPIKey hash
+type APIKeyStore interface {
+	LookupAPIKeyHash(hash string) (*Principal, bool)
+}
+
+// HashedAPIKeyStore is an in memory APIKeyStore, safe for concurrent use
+type HashedAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]Principal
+}
+
+// NewHashedAPIKeyStore creates an empty HashedAPIKeyStore
+func NewHashedAPIKeyStore() *HashedAPIKeyStore {
+	return &HashedAPIKeyStore{keys: map[string]Principal{}}
+}
+
+// Add stores principal for the hex SHA-256 hash of a key, see HashAPIKey
+func (s *HashedAPIKeyStore) Add(hash string, principal Principal) error {
+	decoded, err := hex.DecodeString(hash)
+	if err != nil || len(decoded) != sha256.Size {
+		return pkgerrors.New("API key hash must be a hex SHA-256 hash")
+	}
+	principal.Method = AuthMethodAPIKey
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[strings.ToLower(hash)] = principal
+	return nil
+}
+
+// Remove deletes the key with hash, such as when it is revoked
+func (s *HashedAPIKeyStore) Remove(hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, strings.ToLower(hash))
+}
+
+// LookupAPIKeyHash implements APIKeyStore
+func (s *HashedAPIKeyStore) LookupAPIKeyHash(hash string) (*Principal, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	principal, ok := s.keys[hash]
+	if !ok {
+		return nil, false
+	}
+	return &principal, true
+}
+
+// APIKeyAuthenticator authenticates the API key in a request header
+// against an APIKeyStore
+type APIKeyAuthenticator struct {
+	store  APIKeyStore
+	header string
+}
+
+// NewAPIKeyAuthenticator creates an APIKeyAuthenticator reading the
+// key from header, defaults to DefaultAPIKeyHeader when empty
+func NewAPIKeyAuthenticator(store APIKeyStore, header string) *APIKeyAuthenticator {
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+	return &APIKeyAuthenticator{store: store, header: header}
+}
+
+// Authenticate implements Authenticator
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(a.header)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	principal, ok := a.store.LookupAPIKeyHash(HashAPIKey(key))
+	if !ok {
+		return nil, pkgerrors.Wrap(ErrInvalidCredentials, "unknown API key")
+	}
+	return principal, nil
+}
+
+// Challenge implements Authenticator, API keys have no standard challenge
+func (a *APIKeyAuthenticator) Challenge() string {
+	return ""
+}
+
+// BasicAuthFunc verifies a username and password, returning the
+// Principal and true when they are valid
+type BasicAuthFunc func(username string, password string) (*Principal, bool)
+
+// BasicAuthenticator authenticates the Authorization Basic header
+type BasicAuthenticator struct {
+	realm  string
+	verify BasicAuthFunc
+}
+
+// NewBasicAuthenticator creates a BasicAuthenticator using verify to
+// check the credentials, realm is returned in the challenge
+func NewBasicAuthenticator(realm string, verify BasicAuthFunc) *BasicAuthenticator {
+	return &BasicAuthenticator{realm: realm, verify: verify}
+}
+
+// Authenticate implements Authenticator
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if !hasAuthScheme(r, "Basic") {
+		return nil, ErrNoCredentials
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, pkgerrors.Wrap(ErrInvalidCredentials, "malformed basic auth")
+	}
+	principal, ok := a.verify(username, password)
+	if !ok || principal == nil {
+		return nil, pkgerrors.Wrap(ErrInvalidCredentials, "invalid username or password")
+	}
+	authenticated := *principal // verify may return a shared Principal
+	authenticated.Method = AuthMethodBasic
+	return &authenticated, nil
+}
+
+// Challenge implements Authenticator
+func (a *BasicAuthenticator) Challenge() string {
+	return `Basic realm="` + a.realm + `"`
+}
+
+// hasAuthScheme reports whether the Authorization header uses scheme
+func hasAuthScheme(r *http.Request, scheme string) bool {
+	authorization := r.Header.Get("Authorization")
+	return len(authorization) > len(scheme) &&
+		strings.EqualFold(authorization[:len(scheme)], scheme) &&
+		authorization[len(scheme)] == ' '
+}
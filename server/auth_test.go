@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AuthMiddleware(t *testing.T) {
+	captureLogs(t)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	keys := NewKeySet()
+	keys.AddHMACKey("k1", secret)
+
+	apiKeys := NewHashedAPIKeyStore()
+	require.NoError(t, apiKeys.Add(HashAPIKey("key-123"), Principal{Subject: "batch-job", Scopes: []string{"widgets:read"}}))
+	require.Error(t, apiKeys.Add("not-a-hash", Principal{}))
+
+	admin := &Principal{Subject: "admin", Scopes: []string{"widgets:read", "widgets:write"}}
+	basic := NewBasicAuthenticator("widgets", func(username string, password string) (*Principal, bool) {
+		if username == "admin" && password == "s3cret" {
+			return admin, true
+		}
+		return nil, false
+	})
+
+	var got *Principal
+	handler := AuthMiddleware(
+		NewJWTAuthenticator(keys, WithRealm("widgets")),
+		NewAPIKeyAuthenticator(apiKeys, ""),
+		basic,
+	)(RequireScopes("widgets:read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	})))
+
+	token := signJWT(t, JWTAlgHS256, "k1", secret, map[string]interface{}{
+		"sub":   "user-1",
+		"scope": "widgets:read profile",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	})
+	readOnlyToken := signJWT(t, JWTAlgHS256, "k1", secret, map[string]interface{}{
+		"sub": "user-2",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+
+	tests := []struct {
+		name        string
+		header      string
+		value       string
+		wantStatus  int
+		wantSubject string
+		wantMethod  string
+	}{
+		{name: "jwt", header: "Authorization", value: "Bearer " + token, wantStatus: http.StatusOK, wantSubject: "user-1", wantMethod: AuthMethodJWT},
+		{name: "api key", header: DefaultAPIKeyHeader, value: "key-123", wantStatus: http.StatusOK, wantSubject: "batch-job", wantMethod: AuthMethodAPIKey},
+		{name: "basic", header: "Authorization", value: "Basic YWRtaW46czNjcmV0", wantStatus: http.StatusOK, wantSubject: "admin", wantMethod: AuthMethodBasic},
+		{name: "no credentials", wantStatus: http.StatusUnauthorized},
+		{name: "bad token", header: "Authorization", value: "Bearer a.b.c", wantStatus: http.StatusUnauthorized},
+		{name: "unknown api key", header: DefaultAPIKeyHeader, value: "key-999", wantStatus: http.StatusUnauthorized},
+		{name: "bad password", header: "Authorization", value: "Basic YWRtaW46d3Jvbmc=", wantStatus: http.StatusUnauthorized},
+		{name: "missing scope", header: "Authorization", value: "Bearer " + readOnlyToken, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest(http.MethodGet, "/widgets", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, tt.wantStatus, w.Code)
+			switch tt.wantStatus {
+			case http.StatusOK:
+				require.Equal(t, tt.wantSubject, got.Subject)
+				require.Equal(t, tt.wantMethod, got.Method)
+			case http.StatusUnauthorized:
+				require.Nil(t, got)
+				require.Equal(t, []string{`Bearer realm="widgets"`, `Basic realm="widgets"`}, w.Header().Values("WWW-Authenticate"))
+				require.Equal(t, "Unauthorized", decodeErrorBody(t, w.Body.Bytes())["ExceptionType"])
+			case http.StatusForbidden:
+				require.Equal(t, "Forbidden", decodeErrorBody(t, w.Body.Bytes())["ExceptionType"])
+			}
+		})
+	}
+	require.Equal(t, "", admin.Method, "the Principal returned by verify is not modified")
+
+	apiKeys.Remove(HashAPIKey("key-123"))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/widgets", nil)
+	req.Header.Set(DefaultAPIKeyHeader, "key-123")
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code, "revoked key")
+}
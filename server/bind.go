@@ -0,0 +1,492 @@
+package server
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CodeNamor/Common/datetime"
+	"github.com/CodeNamor/Common/errors"
+	"github.com/gorilla/mux"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// Sources of the values bound by Bind, used in FieldViolation.Source
+const (
+	BindSourcePath   = "path"
+	BindSourceQuery  = "query"
+	BindSourceHeader = "header"
+	BindSourceBody   = "body"
+)
+
+// FieldViolation is a problem with one field of a request
+type FieldViolation struct {
+	Field   string `json:"field"`
+	Source  string `json:"source"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (v FieldViolation) String() string {
+	return v.Source + "." + v.Field + ": " + v.Message
+}
+
+// ValidationError is the Err of the ErrorLog returned by Bind, use
+// errors.As to get the individual violations
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.String())
+	}
+	return strings.Join(messages, "; ")
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+	regexps             = sync.Map{} // compiled regex rules by pattern
+)
+
+// Bind populates the struct pointed to by dst from the request and
+// validates it. Fields are bound by their tags:
+//
+//	path:"id"        mux path variable
+//	query:"limit"    query parameter, repeated or comma separated for slices
+//	header:"X-Tenant"
+//	json:"name"      the JSON request body, decoded into dst first
+//	default:"20"     used when the value is missing
+//	validate:"required,min=1,max=100"
+//
+// Fields with path, query or header tags are never set from the body,
+// and are only bound on the top level struct. A body field is present
+// when its key is in the JSON, so an explicit false or 0 satisfies
+// required and is not replaced by the default.
+//
+// Strings, bools, ints, uints, floats, time.Duration, time.Time (any
+// format datetime.StringToDate supports), encoding.TextUnmarshaler and
+// slices and pointers of them are converted. The validate rules are
+// required, min and max (the value of numbers, the length of strings
+// and slices), regex=pattern (without commas), oneof=a b c and date
+// (a string datetime.StringToDate can parse). Nested structs in the
+// body are validated too. All the problems are returned as one 400
+// *errors.ErrorLog with a *ValidationError Err, ready for WriteError.
+func Bind(r *http.Request, dst interface{}) error {
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Struct {
+		return pkgerrors.Errorf("bind destination must be a pointer to a struct, got %T", dst)
+	}
+	binder := &binder{request: r, pathVars: mux.Vars(r), violations: []FieldViolation{}}
+
+	var body map[string]json.RawMessage
+	if r.Body != nil && r.Body != http.NoBody {
+		raw, err := io.ReadAll(r.Body) // limited by BodyLimitMiddleware
+		r.Body = io.NopCloser(bytes.NewReader(raw))
+		if err != nil {
+			binder.violation("body", BindSourceBody, "read", "unable to read body: %v", err)
+		} else if len(bytes.TrimSpace(raw)) > 0 {
+			restore := saveSourceFields(target.Elem())
+			if err := json.Unmarshal(raw, dst); err != nil {
+				binder.violation("body", BindSourceBody, "json", "invalid JSON: %v", err)
+			} else {
+				json.Unmarshal(raw, &body) // the keys present, nil unless an object
+			}
+			restore()
+		}
+	}
+
+	binder.bindStruct(target.Elem(), "", body)
+	if len(binder.violations) == 0 {
+		return nil
+	}
+
+	validationErr := &ValidationError{Violations: binder.violations}
+	return &errors.ErrorLog{
+		RootCause:             "invalid request",
+		StatusCode:            "400",
+		ExceptionType:         "ValidationError",
+		AdditionalInformation: validationErr.Error(),
+		Err:                   validationErr,
+	}
+}
+
+type binder struct {
+	request    *http.Request
+	pathVars   map[string]string
+	violations []FieldViolation
+}
+
+func (b *binder) violation(field string, source string, rule string, format string, args ...interface{}) {
+	b.violations = append(b.violations, FieldViolation{Field: field, Source: source, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+// bindStruct binds and validates the fields of structValue, prefix is
+// the JSON path of a nested struct and body its JSON object
+func (b *binder) bindStruct(structValue reflect.Value, prefix string, body map[string]json.RawMessage) {
+	structType := structValue.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		value := structValue.Field(i)
+
+		name, source, raw, present := b.sourceValues(field)
+		if source != BindSourceBody && prefix != "" {
+			value.Set(reflect.Zero(value.Type())) // only bound on the top level
+			continue
+		}
+		var fieldJSON json.RawMessage
+		if source == BindSourceBody {
+			jsonName, omitted := jsonFieldName(field)
+			if omitted {
+				continue
+			}
+			if jsonName == "" && field.Anonymous {
+				if embedded := indirectStruct(value); embedded.IsValid() {
+					b.bindStruct(embedded, prefix, body) // flattened as encoding/json does
+					continue
+				}
+			}
+			if jsonName == "" {
+				jsonName = field.Name
+			}
+			name = prefix + jsonName
+			fieldJSON, present = jsonKey(body, jsonName)
+		}
+
+		if present && source != BindSourceBody {
+			if err := setValue(value, raw); err != nil {
+				b.violation(name, source, "type", "%v", err)
+				continue
+			}
+		}
+		if !present {
+			if defaultValue, ok := field.Tag.Lookup("default"); ok {
+				if err := setValue(value, []string{defaultValue}); err != nil {
+					b.violation(name, source, "default", "invalid default: %v", err)
+					continue
+				}
+				present = true
+			}
+		}
+
+		b.validate(field, value, name, source, present)
+		if source == BindSourceBody {
+			b.bindNested(value, name, fieldJSON)
+		}
+	}
+}
+
+// saveSourceFields saves the fields of structValue with path, query or
+// header tags, the returned func restores them after the body is
+// decoded so the body can not set them
+func saveSourceFields(structValue reflect.Value) func() {
+	saved := map[int]reflect.Value{}
+	structType := structValue.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() || !hasSourceTag(field) {
+			continue
+		}
+		value := reflect.New(field.Type).Elem()
+		value.Set(structValue.Field(i))
+		saved[i] = value
+	}
+	return func() {
+		for i, value := range saved {
+			structValue.Field(i).Set(value)
+		}
+	}
+}
+
+func hasSourceTag(field reflect.StructField) bool {
+	for _, tag := range []string{"path", "query", "header"} {
+		if _, ok := field.Tag.Lookup(tag); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonKey returns the value of key in body, matched case insensitively
+// as encoding/json does, and whether it is present and not null
+func jsonKey(body map[string]json.RawMessage, key string) (json.RawMessage, bool) {
+	value, ok := body[key]
+	if !ok {
+		for candidate, candidateValue := range body {
+			if strings.EqualFold(candidate, key) {
+				value, ok = candidateValue, true
+				break
+			}
+		}
+	}
+	if !ok || bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+		return nil, false
+	}
+	return value, true
+}
+
+// indirectStruct returns the struct value is or points to, or an
+// invalid value if it is not a struct or is nil
+func indirectStruct(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct || value.Type() == timeType {
+		return reflect.Value{}
+	}
+	return value
+}
+
+// sourceValues returns the name, source and raw values of field and
+// whether they were present in the request
+func (b *binder) sourceValues(field reflect.StructField) (string, string, []string, bool) {
+	if name, ok := field.Tag.Lookup("path"); ok {
+		value, present := b.pathVars[name]
+		return name, BindSourcePath, []string{value}, present
+	}
+	if name, ok := field.Tag.Lookup("query"); ok {
+		values, present := b.request.URL.Query()[name]
+		return name, BindSourceQuery, values, present && len(values) > 0
+	}
+	if name, ok := field.Tag.Lookup("header"); ok {
+		values := b.request.Header.Values(name)
+		return name, BindSourceHeader, values, len(values) > 0
+	}
+	return "", BindSourceBody, nil, false
+}
+
+// bindNested validates structs nested in the body, raw is their JSON
+func (b *binder) bindNested(value reflect.Value, name string, raw json.RawMessage) {
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	switch {
+	case value.Kind() == reflect.Struct && value.Type() != timeType:
+		var object map[string]json.RawMessage
+		json.Unmarshal(raw, &object)
+		b.bindStruct(value, name+".", object)
+	case value.Kind() == reflect.Slice:
+		var items []json.RawMessage
+		json.Unmarshal(raw, &items)
+		for i := 0; i < value.Len(); i++ {
+			element := value.Index(i)
+			if element.Kind() == reflect.Struct || (element.Kind() == reflect.Ptr && element.Type().Elem().Kind() == reflect.Struct) {
+				var item json.RawMessage
+				if i < len(items) {
+					item = items[i]
+				}
+				b.bindNested(element, name+"["+strconv.Itoa(i)+"]", item)
+			}
+		}
+	}
+}
+
+// validate applies the validate tag rules to value
+func (b *binder) validate(field reflect.StructField, value reflect.Value, name string, source string, present bool) {
+	tag := field.Tag.Get("validate")
+	if tag == "" {
+		return
+	}
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		ruleName, argument := rule, ""
+		if index := strings.Index(rule, "="); index >= 0 {
+			ruleName, argument = rule[:index], rule[index+1:]
+		}
+		ruleName = strings.TrimSpace(ruleName)
+
+		if ruleName == "required" {
+			if !present || (value.Kind() == reflect.Ptr && value.IsNil()) {
+				b.violation(name, source, ruleName, "is required")
+				return // the other rules do not apply to a missing value
+			}
+			continue
+		}
+		if !present || (value.Kind() == reflect.Ptr && value.IsNil()) {
+			return // optional and missing
+		}
+
+		switch ruleName {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(argument, 64)
+			if err != nil {
+				b.violation(name, source, ruleName, "invalid %s rule %q", ruleName, argument)
+				continue
+			}
+			measure, isLength, ok := measureOf(value)
+			if !ok {
+				continue
+			}
+			if ruleName == "min" && measure < limit {
+				b.violation(name, source, ruleName, "%s at least %s", mustBe(isLength), argument)
+			}
+			if ruleName == "max" && measure > limit {
+				b.violation(name, source, ruleName, "%s at most %s", mustBe(isLength), argument)
+			}
+		case "regex":
+			pattern, err := compileRegex(argument)
+			if err != nil {
+				b.violation(name, source, ruleName, "invalid regex rule %q", argument)
+				continue
+			}
+			if value.Kind() == reflect.String && !pattern.MatchString(value.String()) {
+				b.violation(name, source, ruleName, "must match %s", argument)
+			}
+		case "oneof":
+			allowed := strings.Fields(argument)
+			actual := fmt.Sprint(value.Interface())
+			found := false
+			for _, candidate := range allowed {
+				found = found || candidate == actual
+			}
+			if !found {
+				b.violation(name, source, ruleName, "must be one of %s", strings.Join(allowed, ", "))
+			}
+		case "date":
+			if value.Kind() == reflect.String && datetime.StringToDate(value.String()).Equal(datetime.InvalidTime()) {
+				b.violation(name, source, ruleName, "must be a date such as %s", datetime.SearchDateFormat)
+			}
+		}
+	}
+}
+
+// measureOf returns the value of a number or the length of a string or
+// slice, which is what min and max compare
+func measureOf(value reflect.Value) (float64, bool, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), false, true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), true, true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), true, true
+	}
+	return 0, false, false
+}
+
+func mustBe(isLength bool) string {
+	if isLength {
+		return "length must be"
+	}
+	return "must be"
+}
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if compiled, ok := regexps.Load(pattern); ok {
+		return compiled.(*regexp.Regexp), nil
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexps.Store(pattern, compiled)
+	return compiled, nil
+}
+
+// setValue converts raw to the type of value and sets it, slices use
+// every raw value, or split a single value on commas
+func setValue(value reflect.Value, raw []string) error {
+	if value.Kind() == reflect.Slice && value.Type().Elem().Kind() != reflect.Uint8 {
+		if len(raw) == 1 {
+			raw = strings.Split(raw[0], ",")
+		}
+		slice := reflect.MakeSlice(value.Type(), len(raw), len(raw))
+		for i, item := range raw {
+			if err := setScalar(slice.Index(i), strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+		return nil
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	return setScalar(value, raw[0])
+}
+
+func setScalar(value reflect.Value, raw string) error {
+	if value.Kind() == reflect.Ptr {
+		element := reflect.New(value.Type().Elem())
+		if err := setScalar(element.Elem(), raw); err != nil {
+			return err
+		}
+		value.Set(element)
+		return nil
+	}
+	if value.CanAddr() && value.Addr().Type().Implements(textUnmarshalerType) && value.Type() != timeType {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+
+	switch {
+	case value.Type() == timeType:
+		parsed := datetime.StringToDate(raw)
+		if parsed.Equal(datetime.InvalidTime()) {
+			return pkgerrors.Errorf("%q is not a valid date", raw)
+		}
+		value.Set(reflect.ValueOf(parsed))
+	case value.Type() == durationType:
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return pkgerrors.Errorf("%q is not a valid duration", raw)
+		}
+		value.SetInt(int64(parsed))
+	case value.Kind() == reflect.String:
+		value.SetString(raw)
+	case value.Kind() == reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return pkgerrors.Errorf("%q is not a valid boolean", raw)
+		}
+		value.SetBool(parsed)
+	case value.Kind() >= reflect.Int && value.Kind() <= reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return pkgerrors.Errorf("%q is not a valid integer", raw)
+		}
+		value.SetInt(parsed)
+	case value.Kind() >= reflect.Uint && value.Kind() <= reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return pkgerrors.Errorf("%q is not a valid unsigned integer", raw)
+		}
+		value.SetUint(parsed)
+	case value.Kind() == reflect.Float32 || value.Kind() == reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return pkgerrors.Errorf("%q is not a valid number", raw)
+		}
+		value.SetFloat(parsed)
+	default:
+		return pkgerrors.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CodeNamor/Common/errors"
+	"github.com/gorilla/mux"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type widgetAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type bindWidgetRequest struct {
+	ID       int             `path:"id" validate:"min=1"`
+	Limit    int             `query:"limit" default:"20" validate:"min=1,max=100"`
+	Tags     []string        `query:"tag"`
+	Since    time.Time       `query:"since"`
+	Timeout  time.Duration   `query:"timeout"`
+	Verbose  *bool           `query:"verbose"`
+	Tenant   string          `header:"X-Tenant" validate:"required"`
+	Name     string          `json:"name" validate:"required,max=10"`
+	Color    string          `json:"color" validate:"oneof=red green blue"`
+	Code     string          `json:"code" validate:"regex=^[A-Z]{3}$"`
+	Born     string          `json:"born" validate:"date"`
+	Address  *widgetAddress  `json:"address"`
+	Previous []widgetAddress `json:"previous"`
+}
+
+func bindRequest(t *testing.T, target string, header http.Header, body string, dst interface{}) error {
+	t.Helper()
+	var err error
+	router := mux.NewRouter()
+	router.HandleFunc("/widgets/{id}", func(_ http.ResponseWriter, r *http.Request) {
+		err = Bind(r, dst)
+	})
+
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	return err
+}
+
+func violationsOf(t *testing.T, err error) []string {
+	t.Helper()
+	require.Error(t, err)
+	errorLog := &errors.ErrorLog{}
+	require.True(t, pkgerrors.As(err, &errorLog))
+	require.Equal(t, "400", errorLog.StatusCode)
+	require.Equal(t, "ValidationError", errorLog.ExceptionType)
+	validationErr := &ValidationError{}
+	require.True(t, errors.As(err, &validationErr))
+
+	violations := []string{}
+	for _, violation := range validationErr.Violations {
+		violations = append(violations, violation.Source+"."+violation.Field+":"+violation.Rule)
+	}
+	return violations
+}
+
+func Test_Bind(t *testing.T) {
+	header := http.Header{"X-Tenant": {"acme"}}
+
+	t.Run("binds every source", func(t *testing.T) {
+		dst := bindWidgetRequest{}
+		err := bindRequest(t, "/widgets/7?tag=a&tag=b&since=2014-07-09&timeout=5s&verbose=true", header,
+			`{"name":"gear","color":"red","code":"ABC","born":"7/9/2014","address":{"city":"Leeds"}}`, &dst)
+		require.NoError(t, err)
+		require.Equal(t, 7, dst.ID)
+		require.Equal(t, 20, dst.Limit)
+		require.Equal(t, []string{"a", "b"}, dst.Tags)
+		require.Equal(t, time.Date(2014, 7, 9, 0, 0, 0, 0, time.UTC), dst.Since)
+		require.Equal(t, 5*time.Second, dst.Timeout)
+		require.NotNil(t, dst.Verbose)
+		require.True(t, *dst.Verbose)
+		require.Equal(t, "acme", dst.Tenant)
+		require.Equal(t, "gear", dst.Name)
+		require.Equal(t, "Leeds", dst.Address.City)
+	})
+
+	t.Run("comma separated slice", func(t *testing.T) {
+		dst := bindWidgetRequest{}
+		err := bindRequest(t, "/widgets/7?tag=a,b,c", header, `{"name":"gear"}`, &dst)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b", "c"}, dst.Tags)
+	})
+
+	t.Run("empty body", func(t *testing.T) {
+		dst := struct {
+			ID int `path:"id"`
+		}{}
+		require.NoError(t, bindRequest(t, "/widgets/3", nil, "", &dst))
+		require.Equal(t, 3, dst.ID)
+	})
+
+	tests := []struct {
+		name   string
+		target string
+		header http.Header
+		body   string
+		want   []string
+	}{
+		{
+			name:   "missing required",
+			target: "/widgets/7",
+			body:   `{}`,
+			want:   []string{"header.X-Tenant:required", "body.name:required"},
+		},
+		{
+			name:   "conversion",
+			target: "/widgets/7?limit=ten&since=never&timeout=soon",
+			header: header,
+			body:   `{"name":"gear"}`,
+			want:   []string{"query.limit:type", "query.since:type", "query.timeout:type"},
+		},
+		{
+			name:   "rules",
+			target: "/widgets/0?limit=500",
+			header: header,
+			body:   `{"name":"much too long","color":"purple","code":"abc","born":"someday"}`,
+			want: []string{
+				"path.id:min", "query.limit:max", "body.name:max",
+				"body.color:oneof", "body.code:regex", "body.born:date",
+			},
+		},
+		{
+			name:   "nested",
+			target: "/widgets/7",
+			header: header,
+			body:   `{"name":"gear","address":{},"previous":[{"city":"York"},{}]}`,
+			want:   []string{"body.address.city:required", "body.previous[1].city:required"},
+		},
+		{
+			name:   "malformed JSON",
+			target: "/widgets/7",
+			header: header,
+			body:   `{"name":`,
+			want:   []string{"body.body:json", "body.name:required"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dst := bindWidgetRequest{}
+			err := bindRequest(t, tt.target, tt.header, tt.body, &dst)
+			require.Equal(t, tt.want, violationsOf(t, err))
+		})
+	}
+
+	t.Run("explicit zero values are present", func(t *testing.T) {
+		dst := struct {
+			Enabled bool `json:"enabled" default:"true"`
+			Count   int  `json:"count" validate:"required"`
+			Retries int  `json:"retries" default:"3"`
+		}{}
+		require.NoError(t, bindRequest(t, "/widgets/7", nil, `{"enabled":false,"count":0}`, &dst))
+		require.False(t, dst.Enabled)
+		require.Equal(t, 0, dst.Count)
+		require.Equal(t, 3, dst.Retries)
+	})
+
+	t.Run("null is missing", func(t *testing.T) {
+		dst := bindWidgetRequest{}
+		err := bindRequest(t, "/widgets/7", header, `{"name":null}`, &dst)
+		require.Equal(t, []string{"body.name:required"}, violationsOf(t, err))
+	})
+
+	t.Run("body can not set source fields", func(t *testing.T) {
+		dst := bindWidgetRequest{}
+		err := bindRequest(t, "/widgets/7?limit=5", nil, `{"name":"gear","Tenant":"evil","Limit":50,"ID":9}`, &dst)
+		require.Equal(t, []string{"header.X-Tenant:required"}, violationsOf(t, err))
+		require.Equal(t, "", dst.Tenant)
+		require.Equal(t, 5, dst.Limit)
+		require.Equal(t, 7, dst.ID)
+	})
+
+	t.Run("embedded struct", func(t *testing.T) {
+		type Audit struct {
+			Reason string `json:"reason" validate:"required"`
+		}
+		dst := struct {
+			Audit
+			Name string `json:"name"`
+		}{}
+		require.NoError(t, bindRequest(t, "/widgets/7", nil, `{"name":"gear","reason":"restock"}`, &dst))
+		require.Equal(t, "restock", dst.Reason)
+		err := bindRequest(t, "/widgets/7", nil, `{"name":"gear"}`, &dst)
+		require.Equal(t, []string{"body.reason:required"}, violationsOf(t, err))
+	})
+
+	t.Run("not a struct pointer", func(t *testing.T) {
+		dst := bindWidgetRequest{}
+		err := bindRequest(t, "/widgets/7", nil, "", dst)
+		require.Error(t, err)
+		require.False(t, pkgerrors.As(err, new(*errors.ErrorLog)))
+	})
+}
+
+func Test_Bind_WriteError(t *testing.T) {
+	dst := bindWidgetRequest{}
+	var err error
+	router := mux.NewRouter()
+	recorder := httptest.NewRecorder()
+	router.HandleFunc("/widgets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err = Bind(r, &dst); err != nil {
+			WriteError(w, r, err, WithoutLogging())
+		}
+	})
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/widgets/7", strings.NewReader(`{}`)))
+
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "header.X-Tenant: is required")
+	require.Contains(t, recorder.Body.String(), "body.name: is required")
+}
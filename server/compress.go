@@ -0,0 +1,298 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gorilla/mux"
+)
+
+// Defaults used by CompressMiddleware
+const (
+	DefaultCompressMinSize = 1024
+	DefaultGzipLevel       = gzip.DefaultCompression
+	DefaultBrotliLevel     = 4 // good ratio while fast enough for dynamic responses
+)
+
+// DefaultCompressibleTypes are the media types compressed by default,
+// any text/ type is also compressed
+var DefaultCompressibleTypes = []string{
+	ContentTypeJSON,
+	ContentTypeProblemJSON,
+	"application/xml",
+	"application/soap+xml",
+	"application/javascript",
+	"image/svg+xml",
+}
+
+// Content encodings supported by CompressMiddleware
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+)
+
+type compressOptions struct {
+	minSize     int
+	types       map[string]bool
+	gzipLevel   int
+	brotliLevel int
+	brotli      bool
+}
+
+// A CompressOption sets options for CompressMiddleware
+type CompressOption func(*compressOptions)
+
+// WithMinSize is a CompressOption to set the response size below which
+// responses are not compressed, defaults to DefaultCompressMinSize
+func WithMinSize(minSize int) CompressOption {
+	return func(o *compressOptions) {
+		o.minSize = minSize
+	}
+}
+
+// WithCompressibleTypes is a CompressOption to replace the media types
+// which are compressed, defaults to DefaultCompressibleTypes
+func WithCompressibleTypes(mediaTypes ...string) CompressOption {
+	return func(o *compressOptions) {
+		o.types = map[string]bool{}
+		for _, mediaType := range mediaTypes {
+			o.types[mediaType] = true
+		}
+	}
+}
+
+// WithGzipLevel is a CompressOption to set the gzip level, defaults to
+// DefaultGzipLevel
+func WithGzipLevel(level int) CompressOption {
+	return func(o *compressOptions) {
+		o.gzipLevel = level
+	}
+}
+
+// WithBrotliLevel is a CompressOption to set the brotli level from 0 to
+// 11, defaults to DefaultBrotliLevel
+func WithBrotliLevel(level int) CompressOption {
+	return func(o *compressOptions) {
+		o.brotliLevel = level
+	}
+}
+
+// WithoutBrotli is a CompressOption to only use gzip
+func WithoutBrotli() CompressOption {
+	return func(o *compressOptions) {
+		o.brotli = false
+	}
+}
+
+// compressor is the common interface of the gzip and brotli writers
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// CompressMiddleware compresses responses with brotli or gzip, as
+// preferred by the Accept-Encoding header, when the Content-Type is
+// compressible and the body reaches the minimum size. Responses which
+// are flushed before reaching it are compressed if the type is
+// compressible, so streaming works.
+func CompressMiddleware(opt ...CompressOption) mux.MiddlewareFunc {
+	opts := compressOptions{
+		minSize:     DefaultCompressMinSize,
+		gzipLevel:   DefaultGzipLevel,
+		brotliLevel: DefaultBrotliLevel,
+		brotli:      true,
+	}
+	WithCompressibleTypes(DefaultCompressibleTypes...)(&opts)
+	for _, o := range opt {
+		o(&opts)
+	}
+
+	pools := map[string]*sync.Pool{
+		EncodingGzip: {New: func() interface{} {
+			writer, err := gzip.NewWriterLevel(io.Discard, opts.gzipLevel)
+			if err != nil {
+				writer = gzip.NewWriter(io.Discard) // invalid level
+			}
+			return writer
+		}},
+		EncodingBrotli: {New: func() interface{} {
+			return brotli.NewWriterLevel(io.Discard, opts.brotliLevel)
+		}},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), opts.brotli)
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{
+				ResponseWriter: w,
+				opts:           &opts,
+				encoding:       encoding,
+				pool:           pools[encoding],
+				status:         http.StatusOK,
+			}
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks brotli or gzip from an Accept-Encoding header
+// by quality, preferring brotli when they are equal
+func negotiateEncoding(acceptEncoding string, allowBrotli bool) string {
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = parsed
+				}
+			}
+		}
+		if coding == "*" {
+			coding = EncodingGzip
+		}
+		if quality <= 0 || (coding != EncodingGzip && (coding != EncodingBrotli || !allowBrotli)) {
+			continue
+		}
+		if quality > bestQuality || (quality == bestQuality && coding == EncodingBrotli) {
+			best, bestQuality = coding, quality
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the start of the response until it can decide
+// whether to compress, then streams through the compressor
+type compressWriter struct {
+	http.ResponseWriter
+	opts       *compressOptions
+	encoding   string
+	pool       *sync.Pool
+	status     int
+	headerSent bool // WriteHeader was called by the handler
+	decided    bool
+	compressor compressor
+	buffer     bytes.Buffer
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.headerSent {
+		return
+	}
+	c.headerSent = true
+	c.status = status
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		c.decide(false) // no body
+	}
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if !c.decided {
+		c.buffer.Write(b)
+		if c.buffer.Len() < c.opts.minSize {
+			return len(b), nil
+		}
+		if err := c.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if c.compressor != nil {
+		return c.compressor.Write(b)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, compressing the response so far if
+// compression has not been decided yet
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		c.decide(true)
+	}
+	if c.compressor != nil {
+		c.compressor.Flush()
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap allows http.NewResponseController to reach the wrapped writer
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// decide starts compressing if allowed and the content type is
+// compressible, sends the header and writes any buffered body
+func (c *compressWriter) decide(allowed bool) error {
+	c.decided = true
+	header := c.Header()
+	if header.Get("Content-Type") == "" && c.buffer.Len() > 0 {
+		header.Set("Content-Type", http.DetectContentType(c.buffer.Bytes()))
+	}
+	if allowed && header.Get("Content-Encoding") == "" && c.compressible(header.Get("Content-Type")) {
+		c.compressor = c.pool.Get().(compressor)
+		c.compressor.Reset(c.ResponseWriter)
+		header.Set("Content-Encoding", c.encoding)
+		header.Del("Content-Length")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag) // the encoded bytes differ
+		}
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+
+	if c.buffer.Len() == 0 {
+		return nil
+	}
+	var err error
+	if c.compressor != nil {
+		_, err = c.compressor.Write(c.buffer.Bytes())
+	} else {
+		_, err = c.ResponseWriter.Write(c.buffer.Bytes())
+	}
+	c.buffer.Reset()
+	return err
+}
+
+func (c *compressWriter) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return c.opts.types[mediaType] || strings.HasPrefix(mediaType, "text/")
+}
+
+// close writes a small buffered response uncompressed, or finishes the
+// compressed stream, once the handler has returned
+func (c *compressWriter) close() {
+	if !c.decided {
+		if !c.headerSent && c.buffer.Len() == 0 {
+			return // nothing written, let net/http send the default response
+		}
+		c.decide(false)
+		return
+	}
+	if c.compressor != nil {
+		c.compressor.Close()
+		c.compressor.Reset(io.Discard)
+		c.pool.Put(c.compressor)
+		c.compressor = nil
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_negotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		allowBrotli    bool
+		want           string
+	}{
+		{acceptEncoding: "", allowBrotli: true, want: ""},
+		{acceptEncoding: "gzip", allowBrotli: true, want: EncodingGzip},
+		{acceptEncoding: "gzip, deflate, br", allowBrotli: true, want: EncodingBrotli},
+		{acceptEncoding: "gzip, br", allowBrotli: false, want: EncodingGzip},
+		{acceptEncoding: "br;q=0.5, gzip;q=0.8", allowBrotli: true, want: EncodingGzip},
+		{acceptEncoding: "gzip;q=0, identity", allowBrotli: true, want: ""},
+		{acceptEncoding: "*", allowBrotli: true, want: EncodingGzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			require.Equal(t, tt.want, negotiateEncoding(tt.acceptEncoding, tt.allowBrotli))
+		})
+	}
+}
+
+func decompress(t *testing.T, encoding string, body io.Reader) string {
+	var reader io.Reader
+	switch encoding {
+	case EncodingGzip:
+		gzipReader, err := gzip.NewReader(body)
+		require.NoError(t, err)
+		reader = gzipReader
+	case EncodingBrotli:
+		reader = brotli.NewReader(body)
+	default:
+		reader = body
+	}
+	decoded, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(decoded)
+}
+
+func Test_CompressMiddleware(t *testing.T) {
+	large := `{"results":"` + strings.Repeat("widget ", 500) + `"}`
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		status         int
+		wantEncoding   string
+	}{
+		{name: "gzip", acceptEncoding: "gzip", contentType: ContentTypeJSON, body: large, wantEncoding: EncodingGzip},
+		{name: "brotli", acceptEncoding: "gzip, br", contentType: ContentTypeJSON, body: large, wantEncoding: EncodingBrotli},
+		{name: "error status", acceptEncoding: "gzip", contentType: ContentTypeJSON, body: large, status: http.StatusBadGateway, wantEncoding: EncodingGzip},
+		{name: "sniffed text", acceptEncoding: "gzip", body: strings.Repeat("plain ", 500), wantEncoding: EncodingGzip},
+		{name: "too small", acceptEncoding: "gzip", contentType: ContentTypeJSON, body: `{"ok":true}`},
+		{name: "not accepted", contentType: ContentTypeJSON, body: large},
+		{name: "not compressible", acceptEncoding: "gzip", contentType: "image/png", body: large},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CompressMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				for i := 0; i < len(tt.body); i += 100 { // several writes
+					end := i + 100
+					if end > len(tt.body) {
+						end = len(tt.body)
+					}
+					w.Write([]byte(tt.body[i:end]))
+				}
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			wantStatus := tt.status
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			require.Equal(t, wantStatus, w.Code)
+			require.Equal(t, tt.wantEncoding, w.Header().Get("Content-Encoding"))
+			require.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			if tt.wantEncoding != "" {
+				require.Less(t, w.Body.Len(), len(tt.body))
+			}
+			require.Equal(t, tt.body, decompress(t, tt.wantEncoding, w.Body))
+		})
+	}
+}
+
+func Test_CompressMiddleware_NoBody(t *testing.T) {
+	handler := CompressMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Empty(t, w.Header().Get("Content-Encoding"))
+}
+
+func Test_CompressMiddleware_Streaming(t *testing.T) {
+	next := make(chan struct{})
+	server := httptest.NewServer(CompressMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "event %d\n", i)
+			w.(http.Flusher).Flush()
+			<-next
+		}
+	})))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip") // disables the transport's transparent decompression
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, EncodingGzip, res.Header.Get("Content-Encoding"))
+
+	gzipReader, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	lines := bufio.NewReader(gzipReader)
+	for i := 0; i < 3; i++ {
+		line, err := lines.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("event %d\n", i), line, "each event arrives as it is flushed")
+		next <- struct{}{}
+	}
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CodeNamor/Common/errors"
+	"github.com/CodeNamor/Common/logging"
+	"github.com/CodeNamor/Common/logging/logfields"
+	"github.com/ascarter/requestid"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Content types written by WriteError
+const (
+	ContentTypeJSON        = "application/json"
+	ContentTypeProblemJSON = "application/problem+json"
+)
+
+// errorStatuses are the registered mappings used by WriteError when an
+// ErrorLog has no valid StatusCode
+var errorStatuses = struct {
+	mu             sync.RWMutex
+	exceptionTypes map[string]int
+	targets        []errorStatus
+}{
+	exceptionTypes: map[string]int{},
+	targets: []errorStatus{
+		{target: context.DeadlineExceeded, status: http.StatusGatewayTimeout},
+	},
+}
+
+type errorStatus struct {
+	target error
+	status int
+}
+
+// RegisterExceptionTypeStatus maps an ErrorLog ExceptionType, such as
+// "NotFound", to the HTTP status WriteError uses when the ErrorLog has
+// no valid StatusCode
+func RegisterExceptionTypeStatus(exceptionType string, status int) {
+	errorStatuses.mu.Lock()
+	defer errorStatuses.mu.Unlock()
+	errorStatuses.exceptionTypes[exceptionType] = status
+}
+
+// RegisterErrorStatus maps errors matching target with errors.Is, such
+// as sql.ErrNoRows, to the HTTP status WriteError uses when there is no
+// ErrorLog StatusCode or ExceptionType mapping. context.DeadlineExceeded
+// is registered as 504 Gateway Timeout.
+func RegisterErrorStatus(target error, status int) {
+	errorStatuses.mu.Lock()
+	defer errorStatuses.mu.Unlock()
+	errorStatuses.targets = append(errorStatuses.targets, errorStatus{target: target, status: status})
+}
+
+type writeErrorOptions struct {
+	defaultStatus int
+	problemJSON   bool
+	logging       bool
+}
+
+// A WriteErrorOption sets options for WriteError
+type WriteErrorOption func(*writeErrorOptions)
+
+// WithDefaultStatus is a WriteErrorOption to set the status used when
+// none can be derived from the error, defaults to 500
+func WithDefaultStatus(status int) WriteErrorOption {
+	return func(o *writeErrorOptions) {
+		o.defaultStatus = status
+	}
+}
+
+// WithProblemJSON is a WriteErrorOption to always write the RFC 7807
+// application/problem+json form, otherwise it is only written when
+// the request Accept header asks for it
+func WithProblemJSON() WriteErrorOption {
+	return func(o *writeErrorOptions) {
+		o.problemJSON = true
+	}
+}
+
+// WithoutLogging is a WriteErrorOption for callers which have already
+// logged the error
+func WithoutLogging() WriteErrorOption {
+	return func(o *writeErrorOptions) {
+		o.logging = false
+	}
+}
+
+// Problem is the RFC 7807 application/problem+json response body
+// written by WriteError, with the ErrorLog fields as extension members
+type Problem struct {
+	Type          string `json:"type"`
+	Title         string `json:"title"`
+	Status        int    `json:"status"`
+	Detail        string `json:"detail,omitempty"`
+	Instance      string `json:"instance,omitempty"`
+	RequestID     string `json:"requestId,omitempty"`
+	Source        string `json:"source,omitempty"`
+	ExceptionType string `json:"exceptionType,omitempty"`
+	Code          string `json:"code,omitempty"`
+}
+
+// WriteError writes err as a JSON error response. The *errors.ErrorLog
+// is found in err with errors.As, or err is wrapped in one. The status
+// is the ErrorLog StatusCode if it is a valid 4xx or 5xx code,
+// otherwise the status of its registered errors.Code, otherwise a
+// status registered with RegisterExceptionTypeStatus or
+// RegisterErrorStatus, otherwise 500. The body is the ErrorLog JSON
+// with a RequestId field, or the Problem form, whose detail falls back
+// to the user message of the Code when there is no RootCause. The
+// error is logged at the severity of the Code, or at Error level for
+// 5xx responses and Warning level otherwise.
+func WriteError(w http.ResponseWriter, r *http.Request, err error, opt ...WriteErrorOption) {
+	opts := writeErrorOptions{
+		defaultStatus: http.StatusInternalServerError,
+		logging:       true,
+	}
+	for _, o := range opt {
+		o(&opts)
+	}
+
+	errorLog := errorLogOf(err)
+	if errorLog.Code == "" {
+		errorLog.Code = errors.CodeOf(err)
+	}
+	codeInfo, hasCode := errorLog.Code.Info()
+	status := errorStatusOf(err, errorLog, opts.defaultStatus)
+	errorLog.StatusCode = strconv.Itoa(status)
+	requestID, _ := requestid.FromContext(r.Context())
+
+	if opts.logging {
+		entry := logging.WithFields(logrus.Fields{
+			logfields.RequestId:   requestID,
+			logfields.Request:     r.Method,
+			logfields.URI:         r.URL.RequestURI(),
+			logfields.StatusCode:  status,
+			logfields.RootCause:   errorLog.RootCause,
+			logfields.ErrorSource: errorLog.Source,
+		})
+		severity := logging.WarningLevel
+		if hasCode && codeInfo.Severity != 0 {
+			severity = codeInfo.Severity
+		} else if status >= http.StatusInternalServerError {
+			severity = logging.ErrorLevel
+		}
+		logAt(entry, severity, errorLog)
+	}
+
+	if opts.problemJSON || acceptsProblemJSON(r) {
+		detail := errorLog.RootCause
+		if detail == "" && hasCode {
+			detail = codeInfo.UserMessage
+		}
+		if detail == "" && errorLog.Err != nil {
+			detail = errorLog.Err.Error()
+		}
+		w.Header().Set("Content-Type", ContentTypeProblemJSON)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(Problem{
+			Type:          "about:blank",
+			Title:         http.StatusText(status),
+			Status:        status,
+			Detail:        detail,
+			Instance:      r.URL.Path,
+			RequestID:     requestID,
+			Source:        errorLog.Source,
+			ExceptionType: errorLog.ExceptionType,
+			Code:          string(errorLog.Code),
+		})
+		return
+	}
+
+	body := map[string]interface{}{}
+	encoded, _ := json.Marshal(errorLog)
+	json.Unmarshal(encoded, &body)
+	if requestID != "" {
+		body["RequestId"] = requestID
+	}
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// errorLogOf returns a copy of the ErrorLog in err, so the StatusCode
+// can be set without changing the caller's error, or a new ErrorLog
+// wrapping err
+func errorLogOf(err error) *errors.ErrorLog {
+	var found *errors.ErrorLog
+	if pkgerrors.As(err, &found) && found != nil {
+		copied := *found
+		return &copied
+	}
+	if err == nil {
+		err = pkgerrors.New("unknown error")
+	}
+	return &errors.ErrorLog{Err: err}
+}
+
+// errorStatusOf derives the response status as described by WriteError
+func errorStatusOf(err error, errorLog *errors.ErrorLog, defaultStatus int) int {
+	if status, convErr := strconv.Atoi(strings.TrimSpace(errorLog.StatusCode)); convErr == nil && status >= 400 && status <= 599 {
+		return status
+	}
+
+	if info, ok := errorLog.Code.Info(); ok && info.HTTPStatus != 0 {
+		return info.HTTPStatus
+	}
+
+	errorStatuses.mu.RLock()
+	defer errorStatuses.mu.RUnlock()
+	if status, ok := errorStatuses.exceptionTypes[errorLog.ExceptionType]; ok && errorLog.ExceptionType != "" {
+		return status
+	}
+	for _, mapping := range errorStatuses.targets {
+		if pkgerrors.Is(err, mapping.target) {
+			return mapping.status
+		}
+	}
+	return defaultStatus
+}
+
+// logAt logs args on entry at level
+func logAt(entry *logrus.Entry, level logging.Level, args ...interface{}) {
+	switch level {
+	case logging.TraceLevel:
+		entry.Trace(args...)
+	case logging.InfoLevel:
+		entry.Info(args...)
+	case logging.ErrorLevel:
+		entry.Error(args...)
+	default:
+		entry.Warning(args...)
+	}
+}
+
+// acceptsProblemJSON reports whether the Accept header asks for
+// application/problem+json
+func acceptsProblemJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), ContentTypeProblemJSON)
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CodeNamor/Common/errors"
+	"github.com/ascarter/requestid"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+var errWidgetMissing = pkgerrors.New("widget missing")
+
+func Test_WriteError(t *testing.T) {
+	RegisterExceptionTypeStatus("Conflict", http.StatusConflict)
+	RegisterErrorStatus(errWidgetMissing, http.StatusNotFound)
+
+	tests := []struct {
+		name      string
+		err       error
+		opts      []WriteErrorOption
+		wantCode  int
+		wantCause string
+	}{
+		{
+			name:      "StatusCode",
+			err:       errors.NewRootMsgStatusCode("bad input", "name is required", "400"),
+			wantCode:  http.StatusBadRequest,
+			wantCause: "bad input",
+		},
+		{
+			name:      "wrapped ErrorLog",
+			err:       fmt.Errorf("handler: %w", errors.NewRootMsgStatusCode("upstream down", "refused", "502")),
+			wantCode:  http.StatusBadGateway,
+			wantCause: "upstream down",
+		},
+		{
+			name:     "invalid StatusCode uses ExceptionType mapping",
+			err:      &errors.ErrorLog{StatusCode: "OK", ExceptionType: "Conflict", Err: pkgerrors.New("version mismatch")},
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "registered error",
+			err:      pkgerrors.Wrap(errWidgetMissing, "lookup"),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "deadline exceeded",
+			err:      pkgerrors.Wrap(context.DeadlineExceeded, "query"),
+			wantCode: http.StatusGatewayTimeout,
+		},
+		{
+			name:     "plain error",
+			err:      pkgerrors.New("boom"),
+			wantCode: http.StatusInternalServerError,
+		},
+		{
+			name:     "default status",
+			err:      pkgerrors.New("nope"),
+			opts:     []WriteErrorOption{WithDefaultStatus(http.StatusBadRequest)},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			req := httptest.NewRequest(http.MethodGet, "/widgets/1", nil)
+			req = req.WithContext(requestid.NewContext(req.Context(), "rid-1"))
+			w := httptest.NewRecorder()
+			WriteError(w, req, tt.err, tt.opts...)
+
+			require.Equal(t, tt.wantCode, w.Code)
+			require.Equal(t, ContentTypeJSON, w.Header().Get("Content-Type"))
+			body := decodeErrorBody(t, w.Body.Bytes())
+			require.Equal(t, "rid-1", body["RequestId"])
+			require.Equal(t, fmt.Sprint(tt.wantCode), body["StatusCode"])
+			require.Equal(t, tt.wantCause, body["RootCause"])
+			if tt.wantCode >= 500 {
+				require.Contains(t, logs.String(), "level=error")
+			} else {
+				require.Contains(t, logs.String(), "level=warning")
+			}
+		})
+	}
+}
+
+func Test_WriteError_Code(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCode  int
+		wantLevel string
+	}{
+		{
+			name:      "registered code",
+			err:       fmt.Errorf("loading: %w", errors.NewCode(errors.CodeUnavailable, "inventory down")),
+			wantCode:  http.StatusServiceUnavailable,
+			wantLevel: "level=error",
+		},
+		{
+			name:      "code severity",
+			err:       errors.NewCode(errors.CodeNotFound, "widget %d", 9),
+			wantCode:  http.StatusNotFound,
+			wantLevel: "level=info",
+		},
+		{
+			name:      "StatusCode overrides code",
+			err:       &errors.ErrorLog{StatusCode: "410", Code: errors.CodeNotFound, Err: pkgerrors.New("gone")},
+			wantCode:  http.StatusGone,
+			wantLevel: "level=info",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			w := httptest.NewRecorder()
+			WriteError(w, httptest.NewRequest(http.MethodGet, "/widgets/9", nil), tt.err)
+
+			require.Equal(t, tt.wantCode, w.Code)
+			body := decodeErrorBody(t, w.Body.Bytes())
+			require.Equal(t, string(errors.CodeOf(tt.err)), body["Code"])
+			require.Contains(t, logs.String(), tt.wantLevel)
+		})
+	}
+
+	t.Run("problem detail", func(t *testing.T) {
+		captureLogs(t)
+		w := httptest.NewRecorder()
+		WriteError(w, httptest.NewRequest(http.MethodGet, "/widgets/9", nil), errors.NewCode(errors.CodeRateLimited, "tenant %s over quota", "acme"), WithProblemJSON())
+
+		problem := Problem{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		require.Equal(t, http.StatusTooManyRequests, problem.Status)
+		require.Equal(t, "Too many requests, try again later.", problem.Detail)
+		require.Equal(t, "RateLimited", problem.Code)
+	})
+}
+
+func Test_WriteError_DoesNotChangeErr(t *testing.T) {
+	captureLogs(t)
+	errorLog := &errors.ErrorLog{RootCause: "boom", Err: pkgerrors.New("boom")}
+	WriteError(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), errorLog)
+	require.Empty(t, errorLog.StatusCode)
+}
+
+func Test_WriteError_ProblemJSON(t *testing.T) {
+	captureLogs(t)
+	err := &errors.ErrorLog{RootCause: "widget not found", StatusCode: "404", Source: "inventory"}
+
+	for name, setup := range map[string]func(*http.Request) []WriteErrorOption{
+		"option": func(*http.Request) []WriteErrorOption {
+			return []WriteErrorOption{WithProblemJSON()}
+		},
+		"accept header": func(req *http.Request) []WriteErrorOption {
+			req.Header.Set("Accept", ContentTypeProblemJSON)
+			return nil
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/widgets/9", nil)
+			opts := setup(req)
+			w := httptest.NewRecorder()
+			WriteError(w, req, err, opts...)
+
+			require.Equal(t, http.StatusNotFound, w.Code)
+			require.Equal(t, ContentTypeProblemJSON, w.Header().Get("Content-Type"))
+			problem := Problem{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			require.Equal(t, Problem{
+				Type:     "about:blank",
+				Title:    "Not Found",
+				Status:   http.StatusNotFound,
+				Detail:   "widget not found",
+				Instance: "/widgets/9",
+				Source:   "inventory",
+			}, problem)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// ETagMiddleware adds an ETag to successful GET and HEAD responses,
+// such as those of handlers wrapped by DefaultHandler, and responds 304
+// Not Modified when it matches If-None-Match. The ETag is a hash of the
+// body unless the handler sets one. The response is buffered to hash
+// it, a handler which flushes is streamed without an ETag instead.
+func ETagMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ew := &etagWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(ew, r)
+		if ew.streaming {
+			return
+		}
+
+		header := w.Header()
+		if ew.status != http.StatusOK {
+			ew.writeBuffered()
+			return
+		}
+		etag := header.Get("ETag")
+		if etag == "" {
+			sum := sha256.Sum256(ew.buffer.Bytes())
+			etag = `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+			header.Set("ETag", etag)
+		}
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		ew.writeBuffered()
+	})
+}
+
+// etagMatches implements the weak comparison of If-None-Match
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagWriter buffers the response until the handler returns, or until
+// it flushes at which point the response is streamed
+type etagWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	streaming   bool
+	buffer      bytes.Buffer
+}
+
+func (e *etagWriter) WriteHeader(status int) {
+	if e.streaming {
+		e.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if !e.wroteHeader {
+		e.wroteHeader = true
+		e.status = status
+	}
+}
+
+func (e *etagWriter) Write(b []byte) (int, error) {
+	if e.streaming {
+		return e.ResponseWriter.Write(b)
+	}
+	e.wroteHeader = true
+	return e.buffer.Write(b)
+}
+
+// Flush implements http.Flusher by switching to streaming the response
+func (e *etagWriter) Flush() {
+	if !e.streaming {
+		e.streaming = true
+		e.writeBuffered()
+	}
+	if flusher, ok := e.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap allows http.NewResponseController to reach the wrapped writer
+func (e *etagWriter) Unwrap() http.ResponseWriter {
+	return e.ResponseWriter
+}
+
+func (e *etagWriter) writeBuffered() {
+	if !e.wroteHeader && e.buffer.Len() == 0 {
+		return // nothing written, let net/http send the default response
+	}
+	e.ResponseWriter.WriteHeader(e.status)
+	if e.buffer.Len() > 0 {
+		e.ResponseWriter.Write(e.buffer.Bytes())
+		e.buffer.Reset()
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ETagMiddleware(t *testing.T) {
+	body := `{"widgets":[1,2,3]}`
+	handler := ETagMiddleware(DefaultHandler(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte(body))
+	}))
+	serve := func(method string, path string, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodGet, "/widgets", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, body, w.Body.String())
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	w = serve(http.MethodGet, "/widgets", etag)
+	require.Equal(t, http.StatusNotModified, w.Code)
+	require.Empty(t, w.Body.String())
+	require.Equal(t, etag, w.Header().Get("ETag"))
+
+	w = serve(http.MethodGet, "/widgets", `"other", W/`+etag)
+	require.Equal(t, http.StatusNotModified, w.Code, "weak comparison")
+
+	w = serve(http.MethodGet, "/widgets", `"other"`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(http.MethodGet, "/missing", "*")
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Empty(t, w.Header().Get("ETag"))
+
+	w = serve(http.MethodPost, "/widgets", etag)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get("ETag"))
+}
+
+func Test_ETagMiddleware_HandlerETag(t *testing.T) {
+	handler := ETagMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v7"`)
+		w.Write([]byte("widget"))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", `"v7"`)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func Test_ETagMiddleware_Streaming(t *testing.T) {
+	handler := ETagMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("part 1 "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("part 2"))
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, "part 1 part 2", w.Body.String())
+	require.True(t, w.Flushed)
+	require.Empty(t, w.Header().Get("ETag"))
+}
+
+func Test_NewRouter_CompressionAndETags(t *testing.T) {
+	captureLogs(t)
+	router := NewRouter(WithCompression(WithMinSize(10)), WithETags())
+	router.HandleFunc("/widgets", DefaultHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"widgets":["a","b","c","d"]}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/widgets", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, EncodingGzip, w.Header().Get("Content-Encoding"))
+	etag := w.Header().Get("ETag")
+	require.Regexp(t, `^W/"`, etag, "compressed responses have weak ETags")
+	require.Equal(t, `{"widgets":["a","b","c","d"]}`, decompress(t, EncodingGzip, w.Body))
+
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotModified, w.Code)
+	require.Empty(t, w.Header().Get("Content-Encoding"))
+}
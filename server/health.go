@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CodeNamor/Common/logging"
+	"github.com/CodeNamor/Common/logging/logfields"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// Defaults for HealthCheck Timeout and Interval when they are not set
+const (
+	DefaultHealthCheckTimeout  = 5 * time.Second
+	DefaultHealthCheckInterval = 15 * time.Second
+)
+
+// Health statuses of individual checks and of the overall report
+const (
+	HealthStatusUp       = "UP"
+	HealthStatusDown     = "DOWN"
+	HealthStatusPending  = "PENDING"  // check has not completed yet
+	HealthStatusDegraded = "DEGRADED" // only non critical checks are failing
+)
+
+// HealthCheck is a named dependency check such as a DB ping, SOAP
+// endpoint reachability or disk space
+type HealthCheck struct {
+	Name     string
+	Check    func(ctx context.Context) error // returns nil when healthy
+	Timeout  time.Duration                   // defaults to DefaultHealthCheckTimeout
+	Interval time.Duration                   // defaults to DefaultHealthCheckInterval
+	Critical bool                            // a failing critical check makes the service not ready
+}
+
+// HealthCheckResult is the latest result of a HealthCheck
+type HealthCheckResult struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	Critical    bool       `json:"critical"`
+	LatencyMs   float64    `json:"latencyMs"`
+	Error       string     `json:"error,omitempty"`
+	LastChecked *time.Time `json:"lastChecked,omitempty"`
+}
+
+// HealthReport aggregates the results of all the checks
+type HealthReport struct {
+	Status string              `json:"status"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+type registeredCheck struct {
+	check  HealthCheck
+	mu     sync.RWMutex
+	result HealthCheckResult
+	// blocked receives the result of a Check which timed out but has
+	// not returned, only used by the run goroutine
+	blocked chan error
+}
+
+// HealthRegistry runs registered HealthChecks in the background and
+// aggregates their latest results for the readiness handler
+type HealthRegistry struct {
+	mu     sync.RWMutex
+	checks []*registeredCheck
+	ctx    context.Context // set by Start, checks registered later start immediately
+}
+
+// NewHealthRegistry creates an empty HealthRegistry
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{}
+}
+
+// Register adds a check, names must be unique. If the registry has
+// already been started the check starts running immediately.
+func (h *HealthRegistry) Register(check HealthCheck) error {
+	if check.Name == "" || check.Check == nil {
+		return errors.New("health check requires a name and check func")
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = DefaultHealthCheckTimeout
+	}
+	if check.Interval <= 0 {
+		check.Interval = DefaultHealthCheckInterval
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, existing := range h.checks {
+		if existing.check.Name == check.Name {
+			return errors.Errorf("health check %s already registered", check.Name)
+		}
+	}
+	registered := &registeredCheck{
+		check: check,
+		result: HealthCheckResult{
+			Name:     check.Name,
+			Status:   HealthStatusPending,
+			Critical: check.Critical,
+		},
+	}
+	h.checks = append(h.checks, registered)
+	if h.ctx != nil {
+		go registered.run(h.ctx)
+	}
+	return nil
+}
+
+// Start runs every check immediately and then at its interval until
+// ctx is done
+func (h *HealthRegistry) Start(ctx context.Context) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ctx != nil {
+		return // already started
+	}
+	h.ctx = ctx
+	for _, registered := range h.checks {
+		go registered.run(ctx)
+	}
+}
+
+// Report returns the latest results. The status is DOWN if any
+// critical check is failing or has not completed, DEGRADED if only non
+// critical checks are failing, otherwise UP.
+func (h *HealthRegistry) Report() HealthReport {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	report := HealthReport{
+		Status: HealthStatusUp,
+		Checks: make([]HealthCheckResult, 0, len(h.checks)),
+	}
+	for _, registered := range h.checks {
+		registered.mu.RLock()
+		result := registered.result
+		registered.mu.RUnlock()
+		report.Checks = append(report.Checks, result)
+
+		if result.Status == HealthStatusUp {
+			continue
+		}
+		if result.Critical {
+			report.Status = HealthStatusDown
+		} else if report.Status == HealthStatusUp && result.Status == HealthStatusDown {
+			report.Status = HealthStatusDegraded
+		}
+	}
+	return report
+}
+
+func (c *registeredCheck) run(ctx context.Context) {
+	ticker := time.NewTicker(c.check.Interval)
+	defer ticker.Stop()
+	for {
+		c.runOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runOnce runs the Check in a goroutine so one which ignores its
+// context, such as a ping without a deadline, is still reported DOWN
+// after the Timeout. Runs are skipped until a blocked Check returns.
+func (c *registeredCheck) runOnce(ctx context.Context) {
+	if c.blocked != nil {
+		select {
+		case <-c.blocked:
+			c.blocked = nil
+		default:
+			return // still blocked, the result remains DOWN
+		}
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, c.check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	checkErr := make(chan error, 1)
+	go func() {
+		checkErr <- c.check.Check(checkCtx)
+	}()
+	var err error
+	select {
+	case err = <-checkErr:
+		if err == nil && checkCtx.Err() != nil {
+			err = checkCtx.Err() // check ignored its context
+		}
+	case <-checkCtx.Done():
+		err = checkCtx.Err()
+		c.blocked = checkErr
+	}
+	checked := time.Now()
+
+	result := HealthCheckResult{
+		Name:        c.check.Name,
+		Status:      HealthStatusUp,
+		Critical:    c.check.Critical,
+		LatencyMs:   float64(checked.Sub(start)) / float64(time.Millisecond),
+		LastChecked: &checked,
+	}
+	if err != nil {
+		result.Status = HealthStatusDown
+		result.Error = err.Error()
+	}
+
+	c.mu.Lock()
+	previous := c.result.Status
+	c.result = result
+	c.mu.Unlock()
+	if previous != result.Status {
+		logging.WithField(logfields.HealthCheck, c.check.Name).Info("health check status changed to ", result.Status, " ", result.Error)
+	}
+}
+
+// CreateHealthHandler creates a readiness handler which returns
+// 200 OK when the value, which defaults to initialValue, is true and
+// no critical check in registry is failing, otherwise 503 Service
+// Unavailable. The body is the JSON HealthReport. It returns the
+// handler and an update func to set the value, such as to false
+// during shutdown.
+func CreateHealthHandler(registry *HealthRegistry, initialValue bool) (http.HandlerFunc, UpdateFn) {
+	ready := &atomic.Value{}
+	ready.Store(initialValue)
+
+	handler := func(w http.ResponseWriter, _ *http.Request) {
+		report := registry.Report()
+		status := http.StatusOK
+		if !ready.Load().(bool) {
+			report.Status = HealthStatusDown
+			status = http.StatusServiceUnavailable
+		} else if report.Status == HealthStatusDown {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
+
+	updateFn := func(value bool) {
+		ready.Store(value)
+	}
+
+	return handler, updateFn
+}
+
+// CreateAndHandleReadinessLivenessWithHealth is CreateAndHandleReadinessLiveness
+// where the readiness handler also requires the critical checks in
+// registry to be passing, see CreateHealthHandler. Liveness does not
+// depend on the checks, a failing dependency should not restart the pod.
+func CreateAndHandleReadinessLivenessWithHealth(router *mux.Router, readyURLPath string, liveURLPath string, registry *HealthRegistry) (UpdateFn, UpdateFn) {
+	readyInitial := false
+	readyHandler, readyFn := CreateHealthHandler(registry, readyInitial)
+	router.HandleFunc(readyURLPath, readyHandler)
+
+	liveInitial := false
+	livenessHandler, livenessFn := CreateAtomicHandler(liveInitial)
+	router.HandleFunc(liveURLPath, livenessHandler)
+
+	return readyFn, livenessFn // return updater fns
+}
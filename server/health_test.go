@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func getReport(t *testing.T, handler http.Handler, path string) (int, HealthReport) {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	report := HealthReport{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return w.Code, report
+}
+
+func Test_HealthRegistry(t *testing.T) {
+	var dbDown atomic.Bool
+	dbDown.Store(true)
+
+	registry := NewHealthRegistry()
+	require.NoError(t, registry.Register(HealthCheck{
+		Name:     "db",
+		Critical: true,
+		Interval: 10 * time.Millisecond,
+		Check: func(ctx context.Context) error {
+			if dbDown.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	}))
+	require.NoError(t, registry.Register(HealthCheck{
+		Name:    "disk",
+		Timeout: 10 * time.Millisecond,
+		Check: func(ctx context.Context) error {
+			<-ctx.Done() // always times out
+			return ctx.Err()
+		},
+	}))
+	require.Error(t, registry.Register(HealthCheck{Name: "db", Check: func(context.Context) error { return nil }}))
+
+	router := mux.NewRouter()
+	readyFn, liveFn := CreateAndHandleReadinessLivenessWithHealth(router, "/ready", "/live", registry)
+	readyFn(true)
+	liveFn(true)
+
+	// pending critical checks are not ready
+	code, report := getReport(t, router, "/ready")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, HealthStatusDown, report.Status)
+	require.Equal(t, HealthStatusPending, report.Checks[0].Status)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry.Start(ctx)
+
+	require.Eventually(t, func() bool {
+		report := registry.Report()
+		return report.Checks[0].Status == HealthStatusDown && report.Checks[1].Status == HealthStatusDown
+	}, 5*time.Second, 5*time.Millisecond)
+	code, report = getReport(t, router, "/ready")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "connection refused", report.Checks[0].Error)
+	require.Equal(t, context.DeadlineExceeded.Error(), report.Checks[1].Error)
+
+	// non critical failures leave the service ready but degraded
+	dbDown.Store(false)
+	require.Eventually(t, func() bool {
+		return registry.Report().Checks[0].Status == HealthStatusUp
+	}, 5*time.Second, 5*time.Millisecond)
+	code, report = getReport(t, router, "/ready")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, HealthStatusDegraded, report.Status)
+	require.NotNil(t, report.Checks[0].LastChecked)
+
+	// readiness flag still controls the result
+	readyFn(false)
+	code, report = getReport(t, router, "/ready")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, HealthStatusDown, report.Status)
+
+	// liveness does not depend on the checks
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/live", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func Test_HealthRegistry_CheckIgnoringContext(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	defer close(release)
+
+	registry := NewHealthRegistry()
+	require.NoError(t, registry.Register(HealthCheck{
+		Name:     "soap",
+		Critical: true,
+		Timeout:  20 * time.Millisecond,
+		Interval: 5 * time.Millisecond,
+		Check: func(context.Context) error {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return nil
+			}
+			<-release // blocks without looking at its context
+			return nil
+		},
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry.Start(ctx)
+
+	require.Eventually(t, func() bool {
+		return registry.Report().Checks[0].Status == HealthStatusDown
+	}, 5*time.Second, 5*time.Millisecond)
+	report := registry.Report()
+	require.Equal(t, HealthStatusDown, report.Status)
+	require.Equal(t, context.DeadlineExceeded.Error(), report.Checks[0].Error)
+
+	// runs are skipped while the check is blocked
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	require.Equal(t, HealthStatusDown, registry.Report().Checks[0].Status)
+}
+
+func Test_HealthRegistry_RegisterAfterStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry := NewHealthRegistry()
+	registry.Start(ctx)
+	require.Equal(t, HealthStatusUp, registry.Report().Status)
+
+	require.NoError(t, registry.Register(HealthCheck{Name: "soap", Critical: true, Check: func(context.Context) error { return nil }}))
+	require.Eventually(t, func() bool {
+		return registry.Report().Status == HealthStatusUp && registry.Report().Checks[0].Status == HealthStatusUp
+	}, 5*time.Second, 5*time.Millisecond)
+}
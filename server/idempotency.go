@@ -0,0 +1,353 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/CodeNamor/Common/errors"
+	"github.com/CodeNamor/Common/logging"
+	"github.com/gorilla/mux"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// Headers used by IdempotencyMiddleware
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed" // set to "true" on replayed responses
+)
+
+// DefaultIdempotencyTTL is how long IdempotencyMiddleware replays responses
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// StoredResponse is the first response for an idempotency key
+type StoredResponse struct {
+	RequestHash string      `json:"requestHash"` // hash of the method, path and body
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+// IdempotencyStore stores responses by idempotency key, such as
+// MemoryIdempotencyStore or one backed by a shared cache so replays
+// work across instances
+type IdempotencyStore interface {
+	Get(ctx context.Context, key string) (*StoredResponse, bool, error)
+	Set(ctx context.Context, key string, response *StoredResponse, ttl time.Duration) error
+}
+
+type storedEntry struct {
+	response *StoredResponse
+	expires  time.Time
+}
+
+// MemoryIdempotencyStore is an in memory IdempotencyStore where entries
+// expire after their TTL, safe for concurrent use
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]storedEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty MemoryIdempotencyStore
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		entries: map[string]storedEntry{},
+		now:     time.Now,
+	}
+}
+
+// Get implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Get(_ context.Context, key string) (*StoredResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || s.now().After(entry.expires) {
+		return nil, false, nil
+	}
+	return entry.response, true, nil
+}
+
+// Set implements IdempotencyStore, expired entries are removed at most
+// once a minute
+func (s *MemoryIdempotencyStore) Set(_ context.Context, key string, response *StoredResponse, ttl time.Duration) error {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for entryKey, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, entryKey)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.entries[key] = storedEntry{response: response, expires: now.Add(ttl)}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet removed
+func (s *MemoryIdempotencyStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+type idempotencyOptions struct {
+	ttl          time.Duration
+	required     bool
+	methods      map[string]bool
+	maxBodyBytes int64
+}
+
+// An IdempotencyOption sets options for IdempotencyMiddleware
+type IdempotencyOption func(*idempotencyOptions)
+
+// WithIdempotencyTTL is an IdempotencyOption to set how long responses
+// are replayed, defaults to DefaultIdempotencyTTL
+func WithIdempotencyTTL(ttl time.Duration) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithIdempotencyKeyRequired is an IdempotencyOption to reject requests
+// without an Idempotency-Key with 400 Bad Request
+func WithIdempotencyKeyRequired() IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.required = true
+	}
+}
+
+// WithIdempotentMethods is an IdempotencyOption to set the methods the
+// key is honored for, defaults to POST
+func WithIdempotentMethods(methods ...string) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.methods = map[string]bool{}
+		for _, method := range methods {
+			o.methods[method] = true
+		}
+	}
+}
+
+// WithIdempotencyMaxBodyBytes is an IdempotencyOption to set the
+// largest body read to hash it, larger bodies are rejected with 413
+// Request Entity Too Large, defaults to DefaultMaxBodyBytes
+func WithIdempotencyMaxBodyBytes(maxBytes int64) IdempotencyOption {
+	return func(o *idempotencyOptions) {
+		o.maxBodyBytes = maxBytes
+	}
+}
+
+// inflightRequest is closed when the first request for a key completes
+type inflightRequest chan struct{}
+
+// IdempotencyMiddleware honors the Idempotency-Key header. The first
+// response for a key, other than a 5xx which may succeed when retried,
+// is stored and replayed for repeats with the same method, path, query
+// and body. A repeat with a different request gets 422 Unprocessable
+// Entity with an errors.ErrorLog JSON body. Repeats arriving while the
+// first is in flight on this instance wait for it. Keys are scoped to
+// the Principal when AuthMiddleware is used. The body is read to hash
+// it, up to WithIdempotencyMaxBodyBytes.
+func IdempotencyMiddleware(store IdempotencyStore, opt ...IdempotencyOption) mux.MiddlewareFunc {
+	opts := idempotencyOptions{
+		ttl:          DefaultIdempotencyTTL,
+		methods:      map[string]bool{http.MethodPost: true},
+		maxBodyBytes: DefaultMaxBodyBytes,
+	}
+	for _, o := range opt {
+		o(&opts)
+	}
+
+	mu := sync.Mutex{}
+	inflight := map[string]inflightRequest{}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if !opts.methods[r.Method] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if key == "" {
+				if opts.required {
+					WriteError(w, r, &errors.ErrorLog{
+						RootCause:     "missing " + IdempotencyKeyHeader + " header",
+						StatusCode:    "400",
+						ExceptionType: "IdempotencyKeyMissing",
+						Err:           pkgerrors.New("idempotency key is required"),
+					})
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, opts.maxBodyBytes))
+			if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+				WriteError(w, r, &errors.ErrorLog{
+					RootCause:  "request body too large",
+					StatusCode: "413",
+					Err:        pkgerrors.Errorf("request body exceeds %d bytes", tooLarge.Limit),
+				})
+				return
+			}
+			if err != nil {
+				WriteError(w, r, &errors.ErrorLog{
+					RootCause:  "unable to read request body",
+					StatusCode: "400",
+					Err:        err,
+				})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			requestHash := hashRequest(r, body)
+			scopedKey := scopeIdempotencyKey(r, key)
+
+			// wait for an in flight request with the same key
+			for {
+				mu.Lock()
+				waitFor, busy := inflight[scopedKey]
+				if !busy {
+					inflight[scopedKey] = make(inflightRequest)
+					mu.Unlock()
+					break
+				}
+				mu.Unlock()
+				select {
+				case <-waitFor:
+				case <-r.Context().Done():
+					return // client gave up
+				}
+			}
+			defer func() {
+				mu.Lock()
+				close(inflight[scopedKey])
+				delete(inflight, scopedKey)
+				mu.Unlock()
+			}()
+
+			stored, found, err := store.Get(r.Context(), scopedKey)
+			if err != nil {
+				WriteError(w, r, &errors.ErrorLog{
+					RootCause:     "idempotency store unavailable",
+					StatusCode:    "503",
+					ExceptionType: "IdempotencyStoreUnavailable",
+					Err:           err,
+				})
+				return
+			}
+			if found {
+				if stored.RequestHash != requestHash {
+					WriteError(w, r, &errors.ErrorLog{
+						RootCause:     IdempotencyKeyHeader + " was used with a different request",
+						StatusCode:    "422",
+						ExceptionType: "IdempotencyKeyReused",
+						Err:           pkgerrors.Errorf("idempotency key %s reused", key),
+					})
+					return
+				}
+				replayResponse(w, stored)
+				return
+			}
+
+			capture := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(capture, r)
+			if capture.status >= http.StatusInternalServerError {
+				return
+			}
+			response := &StoredResponse{
+				RequestHash: requestHash,
+				Status:      capture.status,
+				Header:      capture.header,
+				Body:        capture.body.Bytes(),
+			}
+			if response.Header == nil {
+				response.Header = w.Header().Clone()
+			}
+			if err := store.Set(context.Background(), scopedKey, response, opts.ttl); err != nil {
+				logging.WithRequestID(r.Context()).Warning("unable to store idempotent response: ", err)
+			}
+		})
+	}
+}
+
+// hashRequest hashes what must match for a repeat to be replayed
+func hashRequest(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// scopeIdempotencyKey prefixes key with the principal so clients can
+// not replay each other's responses
+func scopeIdempotencyKey(r *http.Request, key string) string {
+	if principal, ok := PrincipalFromContext(r.Context()); ok {
+		return principal.Method + ":" + principal.Subject + ":" + key
+	}
+	return key
+}
+
+// replayResponse writes stored, headers already set on w such as the
+// request ID of this request are kept
+func replayResponse(w http.ResponseWriter, stored *StoredResponse) {
+	header := w.Header()
+	for name, values := range stored.Header {
+		if _, exists := header[name]; !exists {
+			header[name] = values
+		}
+	}
+	header.Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+}
+
+// captureWriter writes through to the client while keeping a copy of
+// the status, headers and body
+type captureWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	header      http.Header
+	body        bytes.Buffer
+}
+
+func (c *captureWriter) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.wroteHeader = true
+		c.status = status
+		c.header = c.ResponseWriter.Header().Clone()
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the wrapped writer supports it
+func (c *captureWriter) Flush() {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap allows http.NewResponseController to reach the wrapped writer
+func (c *captureWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
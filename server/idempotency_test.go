@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_IdempotencyMiddleware(t *testing.T) {
+	captureLogs(t)
+	var created int32
+	handler := IdempotencyMiddleware(NewMemoryIdempotencyStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		id := atomic.AddInt32(&created, 1)
+		w.Header().Set("Location", fmt.Sprintf("/widgets/%d", id))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d,"name":%s}`, id, body)
+	}))
+	post := func(key string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/widgets", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	first := post("k1", `"a"`)
+	require.Equal(t, http.StatusCreated, first.Code)
+	require.Equal(t, `{"id":1,"name":"a"}`, first.Body.String())
+
+	replay := post("k1", `"a"`)
+	require.Equal(t, http.StatusCreated, replay.Code)
+	require.Equal(t, first.Body.String(), replay.Body.String())
+	require.Equal(t, "/widgets/1", replay.Header().Get("Location"))
+	require.Equal(t, "true", replay.Header().Get(IdempotentReplayedHeader))
+	require.Equal(t, int32(1), atomic.LoadInt32(&created))
+
+	reused := post("k1", `"b"`)
+	require.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	require.Equal(t, "IdempotencyKeyReused", decodeErrorBody(t, reused.Body.Bytes())["ExceptionType"])
+
+	require.Equal(t, http.StatusCreated, post("k2", `"a"`).Code)
+	require.Equal(t, http.StatusCreated, post("", `"a"`).Code)
+	require.Equal(t, http.StatusCreated, post("", `"a"`).Code)
+	require.Equal(t, int32(4), atomic.LoadInt32(&created), "requests without a key are not deduplicated")
+}
+
+func Test_IdempotencyMiddleware_Options(t *testing.T) {
+	captureLogs(t)
+	store := NewMemoryIdempotencyStore()
+	calls := 0
+	handler := IdempotencyMiddleware(store, WithIdempotencyKeyRequired(), WithIdempotentMethods(http.MethodPut))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	serve := func(method string, path string, key string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "/", ""))
+	require.Equal(t, http.StatusOK, serve(http.MethodPost, "/", ""), "POST is not configured")
+	require.Equal(t, http.StatusBadGateway, serve(http.MethodPut, "/fail", "k"))
+	require.Equal(t, http.StatusBadGateway, serve(http.MethodPut, "/fail", "k"))
+	require.Equal(t, 3, calls, "server errors are not stored")
+	require.Equal(t, 0, store.Len())
+}
+
+func Test_IdempotencyMiddleware_RequestMatching(t *testing.T) {
+	captureLogs(t)
+	var calls int32
+	handler := IdempotencyMiddleware(NewMemoryIdempotencyStore(), WithIdempotencyMaxBodyBytes(8))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	post := func(target string, body string) int {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "k")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, post("/transfers?to=alice", "{}"))
+	require.Equal(t, http.StatusOK, post("/transfers?to=alice", "{}"))
+	require.Equal(t, http.StatusUnprocessableEntity, post("/transfers?to=mallory", "{}"))
+	require.Equal(t, http.StatusRequestEntityTooLarge, post("/transfers?to=alice", `{"amount":100}`))
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func Test_IdempotencyMiddleware_ConcurrentDuplicates(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	handler := IdempotencyMiddleware(NewMemoryIdempotencyStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Write([]byte("done"))
+	}))
+
+	results := make([]string, 5)
+	wg := sync.WaitGroup{}
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("same"))
+			req.Header.Set(IdempotencyKeyHeader, "dup")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			results[i] = w.Body.String()
+		}(i)
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond) // let the duplicates start waiting
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, result := range results {
+		require.Equal(t, "done", result)
+	}
+}
+
+func Test_MemoryIdempotencyStore_TTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryIdempotencyStore()
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Set(ctx, "a", &StoredResponse{Status: http.StatusCreated}, time.Minute))
+	stored, found, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, http.StatusCreated, stored.Status)
+
+	now = now.Add(2 * time.Minute)
+	_, found, _ = store.Get(ctx, "a")
+	require.False(t, found, "expired")
+
+	require.NoError(t, store.Set(ctx, "b", &StoredResponse{}, time.Minute))
+	require.Equal(t, 1, store.Len(), "expired entries are removed")
+}
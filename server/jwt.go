@@ -0,0 +1,386 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+// Supported JWT signing algorithms
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+	JWTAlgES256 = "ES256"
+)
+
+// DefaultJWTLeeway is the clock skew allowed checking exp and nbf
+const DefaultJWTLeeway = 30 * time.Second
+
+// KeySet holds the keys JWTs are verified with, by key ID. HMAC keys
+// are []byte, others *rsa.PublicKey or *ecdsa.PublicKey. It is safe for
+// concurrent use so keys can be rotated while serving.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys map[string]interface{}
+}
+
+// NewKeySet creates an empty KeySet
+func NewKeySet() *KeySet {
+	return &KeySet{keys: map[string]interface{}{}}
+}
+
+// AddHMACKey adds an HS256 secret with key ID kid
+func (k *KeySet) AddHMACKey(kid string, secret []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[kid] = secret
+}
+
+// AddPublicKey adds an RS256 *rsa.PublicKey or ES256 P-256
+// *ecdsa.PublicKey with key ID kid
+func (k *KeySet) AddPublicKey(kid string, key crypto.PublicKey) error {
+	switch typed := key.(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		if typed.Curve != elliptic.P256() {
+			return pkgerrors.New("only P-256 ECDSA keys are supported")
+		}
+	default:
+		return pkgerrors.Errorf("unsupported public key type %T", key)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[kid] = key
+	return nil
+}
+
+// key returns the key for kid, or the only key if kid is empty and
+// there is just one
+func (k *KeySet) key(kid string) (interface{}, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// jwk is a JSON Web Key as found in a JWKS document
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// LoadJWKSFile reads a JSON Web Key Set file, such as one synced from
+// the identity provider, into a new KeySet. RSA, P-256 EC and oct keys
+// are supported, keys with "use" other than "sig" are skipped.
+func LoadJWKSFile(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, pkgerrors.Wrap(err, "unable to read JWKS file")
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses a JSON Web Key Set document into a new KeySet
+func ParseJWKS(data []byte) (*KeySet, error) {
+	document := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, pkgerrors.Wrap(err, "unable to parse JWKS")
+	}
+
+	keySet := NewKeySet()
+	for _, key := range document.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		switch key.Kty {
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil {
+				return nil, pkgerrors.Wrapf(err, "invalid oct key %s", key.Kid)
+			}
+			keySet.AddHMACKey(key.Kid, secret)
+		case "RSA":
+			n, errN := decodeBigInt(key.N)
+			e, errE := decodeBigInt(key.E)
+			if errN != nil || errE != nil || !e.IsInt64() {
+				return nil, pkgerrors.Errorf("invalid RSA key %s", key.Kid)
+			}
+			if err := keySet.AddPublicKey(key.Kid, &rsa.PublicKey{N: n, E: int(e.Int64())}); err != nil {
+				return nil, pkgerrors.Wrapf(err, "invalid RSA key %s", key.Kid)
+			}
+		case "EC":
+			if key.Crv != "P-256" {
+				return nil, pkgerrors.Errorf("unsupported curve %s for key %s", key.Crv, key.Kid)
+			}
+			x, errX := decodeBigInt(key.X)
+			y, errY := decodeBigInt(key.Y)
+			if errX != nil || errY != nil || !elliptic.P256().IsOnCurve(x, y) {
+				return nil, pkgerrors.Errorf("invalid EC key %s", key.Kid)
+			}
+			if err := keySet.AddPublicKey(key.Kid, &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}); err != nil {
+				return nil, pkgerrors.Wrapf(err, "invalid EC key %s", key.Kid)
+			}
+		default:
+			return nil, pkgerrors.Errorf("unsupported key type %s for key %s", key.Kty, key.Kid)
+		}
+	}
+	return keySet, nil
+}
+
+func decodeBigInt(encoded string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(decoded) == 0 {
+		return nil, pkgerrors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
+
+type jwtOptions struct {
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	scopeClaim string
+	realm      string
+	now        func() time.Time
+}
+
+// A JWTOption sets options for NewJWTAuthenticator
+type JWTOption func(*jwtOptions)
+
+// WithIssuer is a JWTOption to require the iss claim to equal issuer
+func WithIssuer(issuer string) JWTOption {
+	return func(o *jwtOptions) {
+		o.issuer = issuer
+	}
+}
+
+// WithAudience is a JWTOption to require the aud claim to contain audience
+func WithAudience(audience string) JWTOption {
+	return func(o *jwtOptions) {
+		o.audience = audience
+	}
+}
+
+// WithLeeway is a JWTOption to set the clock skew allowed checking exp
+// and nbf, defaults to DefaultJWTLeeway
+func WithLeeway(leeway time.Duration) JWTOption {
+	return func(o *jwtOptions) {
+		o.leeway = leeway
+	}
+}
+
+// WithScopeClaim is a JWTOption to set the claim holding the space
+// separated or array scopes, defaults to "scope"
+func WithScopeClaim(claim string) JWTOption {
+	return func(o *jwtOptions) {
+		o.scopeClaim = claim
+	}
+}
+
+// WithRealm is a JWTOption to set the realm returned in the challenge
+func WithRealm(realm string) JWTOption {
+	return func(o *jwtOptions) {
+		o.realm = realm
+	}
+}
+
+// JWTAuthenticator authenticates Authorization Bearer JWTs signed with
+// HS256, RS256 or ES256 by a key in a KeySet. The exp claim is
+// required, nbf is checked when present.
+type JWTAuthenticator struct {
+	keys *KeySet
+	opts jwtOptions
+}
+
+// NewJWTAuthenticator creates a JWTAuthenticator verifying with keys
+func NewJWTAuthenticator(keys *KeySet, opt ...JWTOption) *JWTAuthenticator {
+	opts := jwtOptions{
+		leeway:     DefaultJWTLeeway,
+		scopeClaim: "scope",
+		now:        time.Now,
+	}
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &JWTAuthenticator{keys: keys, opts: opts}
+}
+
+// Authenticate implements Authenticator
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if !hasAuthScheme(r, "Bearer") {
+		return nil, ErrNoCredentials
+	}
+	claims, err := a.Verify(strings.TrimSpace(r.Header.Get("Authorization")[len("Bearer "):]))
+	if err != nil {
+		return nil, err
+	}
+	subject, _ := claims["sub"].(string)
+	return &Principal{
+		Subject: subject,
+		Method:  AuthMethodJWT,
+		Scopes:  scopesOf(claims[a.opts.scopeClaim]),
+		Claims:  claims,
+	}, nil
+}
+
+// Challenge implements Authenticator
+func (a *JWTAuthenticator) Challenge() string {
+	if a.opts.realm == "" {
+		return "Bearer"
+	}
+	return `Bearer realm="` + a.opts.realm + `"`
+}
+
+// Verify checks the signature and claims of token returning the claims.
+// Errors wrap ErrInvalidCredentials.
+func (a *JWTAuthenticator) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, pkgerrors.Wrap(ErrInvalidCredentials, "malformed token")
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, pkgerrors.Wrap(ErrInvalidCredentials, "malformed token header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, pkgerrors.Wrap(ErrInvalidCredentials, "malformed token signature")
+	}
+	key, ok := a.keys.key(header.Kid)
+	if !ok {
+		return nil, pkgerrors.Wrapf(ErrInvalidCredentials, "unknown key %q", header.Kid)
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, pkgerrors.Wrap(ErrInvalidCredentials, "malformed token claims")
+	}
+	if err := a.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// verifyJWTSignature checks the signature, the key type must match alg
+// so an RSA public key can not be used as an HMAC secret
+func verifyJWTSignature(alg string, key interface{}, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	valid := false
+	switch typed := key.(type) {
+	case []byte:
+		if alg == JWTAlgHS256 {
+			mac := hmac.New(sha256.New, typed)
+			mac.Write([]byte(signed))
+			valid = hmac.Equal(signature, mac.Sum(nil))
+		}
+	case *rsa.PublicKey:
+		if alg == JWTAlgRS256 {
+			valid = rsa.VerifyPKCS1v15(typed, crypto.SHA256, digest[:], signature) == nil
+		}
+	case *ecdsa.PublicKey:
+		if alg == JWTAlgES256 && len(signature) == 64 {
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			valid = ecdsa.Verify(typed, digest[:], r, s)
+		}
+	}
+	if !valid {
+		return pkgerrors.Wrapf(ErrInvalidCredentials, "invalid %s signature", alg)
+	}
+	return nil
+}
+
+func (a *JWTAuthenticator) checkClaims(claims map[string]interface{}) error {
+	now := a.opts.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return pkgerrors.Wrap(ErrInvalidCredentials, "token has no exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(a.opts.leeway)) {
+		return pkgerrors.Wrap(ErrInvalidCredentials, "token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.opts.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return pkgerrors.Wrap(ErrInvalidCredentials, "token is not valid yet")
+	}
+	if a.opts.issuer != "" && claims["iss"] != a.opts.issuer {
+		return pkgerrors.Wrap(ErrInvalidCredentials, "token has the wrong issuer")
+	}
+	if a.opts.audience != "" && !containsString(claims["aud"], a.opts.audience) {
+		return pkgerrors.Wrap(ErrInvalidCredentials, "token has the wrong audience")
+	}
+	return nil
+}
+
+func decodeJWTSegment(segment string, v interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, v)
+}
+
+// containsString reports whether claim, a string or array of strings,
+// contains value
+func containsString(claim interface{}, value string) bool {
+	switch typed := claim.(type) {
+	case string:
+		return typed == value
+	case []interface{}:
+		for _, item := range typed {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scopesOf returns the scopes from a space separated or array claim
+func scopesOf(claim interface{}) []string {
+	switch typed := claim.(type) {
+	case string:
+		return strings.Fields(typed)
+	case []interface{}:
+		scopes := []string{}
+		for _, item := range typed {
+			if scope, ok := item.(string); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
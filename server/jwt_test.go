@@ -0,0 +1,148 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// signJWT creates a token signed with key, which is a []byte HMAC
+// secret, *rsa.PrivateKey or *ecdsa.PrivateKey
+func signJWT(t *testing.T, alg string, kid string, key interface{}, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch typed := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, typed)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, typed, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, typed, digest[:])
+		require.NoError(t, err)
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func Test_JWTAuthenticator_Verify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	keys := NewKeySet()
+	keys.AddHMACKey("hmac", secret)
+	require.NoError(t, keys.AddPublicKey("rsa", &rsaKey.PublicKey))
+	require.NoError(t, keys.AddPublicKey("ec", &ecKey.PublicKey))
+
+	now := time.Unix(1700000000, 0)
+	authenticator := NewJWTAuthenticator(keys, WithIssuer("https://idp"), WithAudience("widgets"))
+	authenticator.opts.now = func() time.Time { return now }
+
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"sub": "user-1",
+			"iss": "https://idp",
+			"aud": []string{"other", "widgets"},
+			"exp": now.Add(time.Minute).Unix(),
+		}
+		for name, value := range overrides {
+			if value == nil {
+				delete(claims, name)
+				continue
+			}
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{name: "HS256", token: signJWT(t, JWTAlgHS256, "hmac", secret, claims(nil))},
+		{name: "RS256", token: signJWT(t, JWTAlgRS256, "rsa", rsaKey, claims(nil))},
+		{name: "ES256", token: signJWT(t, JWTAlgES256, "ec", ecKey, claims(nil))},
+		{name: "within leeway", token: signJWT(t, JWTAlgHS256, "hmac", secret, claims(map[string]interface{}{"exp": now.Add(-10 * time.Second).Unix()}))},
+		{name: "expired", token: signJWT(t, JWTAlgHS256, "hmac", secret, claims(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()})), wantErr: "expired"},
+		{name: "no exp", token: signJWT(t, JWTAlgHS256, "hmac", secret, claims(map[string]interface{}{"exp": nil})), wantErr: "no exp"},
+		{name: "not yet valid", token: signJWT(t, JWTAlgHS256, "hmac", secret, claims(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()})), wantErr: "not valid yet"},
+		{name: "wrong issuer", token: signJWT(t, JWTAlgHS256, "hmac", secret, claims(map[string]interface{}{"iss": "https://evil"})), wantErr: "issuer"},
+		{name: "wrong audience", token: signJWT(t, JWTAlgHS256, "hmac", secret, claims(map[string]interface{}{"aud": "other"})), wantErr: "audience"},
+		{name: "unknown key", token: signJWT(t, JWTAlgHS256, "missing", secret, claims(nil)), wantErr: "unknown key"},
+		{name: "wrong secret", token: signJWT(t, JWTAlgHS256, "hmac", []byte("guess"), claims(nil)), wantErr: "signature"},
+		{name: "alg does not match key", token: signJWT(t, JWTAlgHS256, "rsa", secret, claims(nil)), wantErr: "signature"},
+		{name: "alg none", token: signJWT(t, "none", "hmac", secret, claims(nil)), wantErr: "signature"},
+		{name: "malformed", token: "abc.def", wantErr: "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := authenticator.Verify(tt.token)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "user-1", got["sub"])
+		})
+	}
+}
+
+func Test_LoadJWKSFile(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecKey.X.Bytes()), "y": encode(ecKey.Y.Bytes())},
+		{"kty": "oct", "kid": "hmac", "k": encode([]byte("secret"))},
+		{"kty": "RSA", "kid": "encryption", "use": "enc", "n": "", "e": ""},
+	}})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwks, 0600))
+
+	keys, err := LoadJWKSFile(path)
+	require.NoError(t, err)
+	authenticator := NewJWTAuthenticator(keys)
+	exp := map[string]interface{}{"sub": "svc", "exp": time.Now().Add(time.Minute).Unix()}
+	for kid, key := range map[string]interface{}{"rsa": rsaKey, "ec": ecKey, "hmac": []byte("secret")} {
+		alg := map[string]string{"rsa": JWTAlgRS256, "ec": JWTAlgES256, "hmac": JWTAlgHS256}[kid]
+		_, err := authenticator.Verify(signJWT(t, alg, kid, key, exp))
+		require.NoError(t, err, kid)
+	}
+	_, ok := keys.key("encryption")
+	require.False(t, ok, "keys not used for signatures are skipped")
+
+	_, err = ParseJWKS([]byte(`{"keys":[{"kty":"EC","kid":"bad","crv":"P-384","x":"AA","y":"AA"}]}`))
+	require.ErrorContains(t, err, "unsupported curve")
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// ListenerConfig is an additional address the server handler is served
+// on, see WithListener
+type ListenerConfig struct {
+	Network    string      // "tcp" or "unix", defaults to "tcp"
+	Addr       string      // host:port, or the socket path for "unix"
+	H2C        bool        // also serve cleartext HTTP/2 (h2c)
+	SocketMode os.FileMode // permissions of a unix socket, zero leaves the default
+}
+
+// WithListener is an Option to serve the same handler on an additional
+// listener, such as a unix domain socket for a sidecar or an h2c port
+// for internal clients. Every listener shares the lifecycle of the
+// server, they are drained together on shutdown and if one fails the
+// others are shut down. The additional listeners serve plaintext.
+func WithListener(config ListenerConfig) Option {
+	return func(o *options) {
+		o.listeners = append(o.listeners, config)
+	}
+}
+
+// WithH2C is an Option to also serve cleartext HTTP/2 (h2c) on the main
+// listener. HTTP/2 is always available when serving TLS.
+func WithH2C() Option {
+	return func(o *options) {
+		o.h2c = true
+	}
+}
+
+// ListenerError is the error of an individual listener, returned by Run
+// and Serve. Failures of several listeners are joined.
+type ListenerError struct {
+	Network string
+	Addr    string
+	Err     error
+}
+
+func (e *ListenerError) Error() string {
+	return "listener " + e.Network + " " + e.Addr + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ListenerError) Unwrap() error {
+	return e.Err
+}
+
+// servedListener is a listener and the server serving it
+type servedListener struct {
+	srv   *http.Server
+	ln    net.Listener
+	serve func(ln net.Listener) error
+}
+
+// err wraps a serve error in a ListenerError, returning nil for a
+// normal shutdown
+func (s servedListener) err(err error) error {
+	if err == nil || isNormalShutdown(err) {
+		return nil
+	}
+	return &ListenerError{Network: s.ln.Addr().Network(), Addr: s.ln.Addr().String(), Err: err}
+}
+
+// listen opens the listener for config, removing a stale unix socket
+// left by a previous process
+func listen(config ListenerConfig) (net.Listener, error) {
+	network := config.Network
+	if network == "" {
+		network = "tcp"
+	}
+	if network == "unix" {
+		if info, err := os.Stat(config.Addr); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(config.Addr)
+		}
+	}
+
+	ln, err := net.Listen(network, config.Addr)
+	if err != nil {
+		return nil, &ListenerError{Network: network, Addr: config.Addr, Err: err}
+	}
+	if network == "unix" && config.SocketMode != 0 {
+		if err := os.Chmod(config.Addr, config.SocketMode); err != nil {
+			ln.Close()
+			return nil, &ListenerError{Network: network, Addr: config.Addr, Err: errors.Wrap(err, "unable to set socket mode")}
+		}
+	}
+	return ln, nil
+}
+
+// newListenerServer creates a server for an additional listener with
+// the same handler, timeouts and limits as srv
+func newListenerServer(srv *http.Server, handler http.Handler, config ListenerConfig) *http.Server {
+	listenerSrv := &http.Server{
+		Addr:              config.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: srv.ReadHeaderTimeout,
+		ReadTimeout:       srv.ReadTimeout,
+		WriteTimeout:      srv.WriteTimeout,
+		IdleTimeout:       srv.IdleTimeout,
+		MaxHeaderBytes:    srv.MaxHeaderBytes,
+		ErrorLog:          srv.ErrorLog,
+		BaseContext:       srv.BaseContext,
+		ConnContext:       srv.ConnContext,
+	}
+	if config.H2C {
+		enableH2C(listenerSrv)
+	}
+	return listenerSrv
+}
+
+// enableH2C wraps the handler of srv to also serve h2c, registering the
+// HTTP/2 server so Shutdown gracefully closes HTTP/2 connections too
+func enableH2C(srv *http.Server) {
+	h2s := &http2.Server{IdleTimeout: srv.IdleTimeout}
+	http2.ConfigureServer(srv, h2s)
+	srv.Handler = h2c.NewHandler(handlerOrDefault(srv.Handler), h2s)
+}
+
+func handlerOrDefault(handler http.Handler) http.Handler {
+	if handler == nil {
+		return http.DefaultServeMux
+	}
+	return handler
+}
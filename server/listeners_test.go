@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+// freeAddr returns a local TCP address which is not in use
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+	return addr
+}
+
+// socketPath returns a short unix socket path, the length is limited
+func socketPath(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "srv")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "api.sock")
+}
+
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+// getBodyWith is getBody using client
+func getBodyWith(t *testing.T, client *http.Client, url string) string {
+	res, err := client.Get(url)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func Test_Serve_MultipleListeners(t *testing.T) {
+	sock := socketPath(t)
+	stale, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close() // leaves the socket file behind like a crashed process
+
+	h2cAddr := freeAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	url, result := startServe(t, ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "HTTP/%d", r.ProtoMajor)
+	}),
+		WithListener(ListenerConfig{Network: "unix", Addr: sock, SocketMode: 0660}),
+		WithListener(ListenerConfig{Addr: h2cAddr, H2C: true}),
+		WithH2C(),
+	)
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(sock)
+		return err == nil
+	}, time.Second, time.Millisecond)
+	require.Equal(t, "HTTP/1", getBody(t, url))
+	require.Equal(t, "HTTP/2", getBodyWith(t, h2cClient(), url), "main listener with WithH2C")
+	require.Equal(t, "HTTP/1", getBodyWith(t, unixClient(sock), "http://unix/"))
+	require.Equal(t, "HTTP/2", getBodyWith(t, h2cClient(), "http://"+h2cAddr))
+	info, err := os.Stat(sock)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0660), info.Mode().Perm())
+
+	cancel()
+	select {
+	case err := <-result:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+	_, err = http.Get("http://" + h2cAddr)
+	require.Error(t, err, "all listeners are shut down")
+	_, err = os.Stat(sock)
+	require.True(t, os.IsNotExist(err), "socket is removed")
+}
+
+func Test_Serve_ListenerError(t *testing.T) {
+	inUse, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer inUse.Close()
+
+	hookRun := false
+	url, result := startServe(t, context.Background(), http.NotFoundHandler(),
+		WithListener(ListenerConfig{Addr: inUse.Addr().String()}),
+		WithShutdownHook("hook", func(context.Context) error {
+			hookRun = true
+			return nil
+		}),
+	)
+
+	var err2 error
+	select {
+	case err2 = <-result:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+	}
+	listenerErr := &ListenerError{}
+	require.ErrorAs(t, err2, &listenerErr)
+	require.Equal(t, "tcp", listenerErr.Network)
+	require.Equal(t, inUse.Addr().String(), listenerErr.Addr)
+	require.True(t, hookRun)
+	_, err = http.Get(url)
+	require.Error(t, err, "main listener is closed")
+}
+
+func Test_joinListenerErrors(t *testing.T) {
+	require.NoError(t, joinListenerErrors([]error{nil, nil}))
+
+	first := &ListenerError{Network: "tcp", Addr: ":1", Err: io.EOF}
+	require.Same(t, first, joinListenerErrors([]error{nil, first}))
+
+	second := &ListenerError{Network: "unix", Addr: "/tmp/s", Err: io.ErrUnexpectedEOF}
+	joined := joinListenerErrors([]error{first, second})
+	require.ErrorIs(t, joined, io.EOF)
+	require.ErrorIs(t, joined, io.ErrUnexpectedEOF)
+	require.Equal(t, "listener tcp :1: EOF\nlistener unix /tmp/s: unexpected EOF", joined.Error())
+}
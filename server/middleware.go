@@ -0,0 +1,310 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CodeNamor/Common/errors"
+	"github.com/CodeNamor/Common/logging"
+	"github.com/CodeNamor/Common/logging/logfields"
+	"github.com/CodeNamor/Common/requestclient"
+	"github.com/CodeNamor/Common/telemetry"
+	"github.com/ascarter/requestid"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Defaults used by NewRouter for the standard middleware stack
+const (
+	DefaultRequestIDHeader = requestclient.DefaultRequestIDHeader
+	DefaultRequestTimeout  = 30 * time.Second
+	DefaultMaxBodyBytes    = 10 << 20 // 10 MB
+	DefaultReadyURLPath    = "/ready"
+	DefaultLiveURLPath     = "/live"
+)
+
+// MaxRequestIDLength is the longest request ID RequestIDMiddleware
+// accepts from the request header
+const MaxRequestIDLength = 128
+
+// RequestIDMiddleware propagates the request ID from the header, or
+// generates one if it is missing, longer than MaxRequestIDLength or has
+// characters other than letters, digits and -_.:+=/@, so it is safe
+// to log and return, storing it in the request context
+// with github.com/ascarter/requestid so logging.WithRequestID and the
+// requestclient.PropagatingClient can use it. The ID is also returned
+// in the response header.
+func RequestIDMiddleware(header string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(header)
+			if !validRequestID(requestID) {
+				requestID = uuid.New().String()
+				r.Header.Set(header, requestID)
+			}
+			w.Header().Set(header, requestID)
+			next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), requestID)))
+		})
+	}
+}
+
+// validRequestID reports whether requestID is non empty, at most
+// MaxRequestIDLength bytes and only has token characters
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > MaxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		c := requestID[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.:+=/@", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// TraceContextMiddleware stores the W3C trace context from the
+// traceparent and tracestate headers in the request context, starting
+// a new trace if they are missing or invalid, so outbound calls made
+// through a requestclient.PropagatingClient continue the trace
+func TraceContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc, err := requestclient.ParseTraceParent(r.Header.Get(requestclient.TraceParentHeader))
+		if err != nil {
+			tc = requestclient.NewTraceContext()
+		} else {
+			tc.State = r.Header.Get(requestclient.TraceStateHeader)
+		}
+		next.ServeHTTP(w, r.WithContext(requestclient.ContextWithTraceContext(r.Context(), tc)))
+	})
+}
+
+// AccessLogMiddleware logs each request at the Info level with the
+// standard logfields keys once it has completed
+func AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stopWatch := (&telemetry.StopWatch{}).Start()
+		recorder := newResponseRecorder(w)
+		next.ServeHTTP(recorder, r)
+		stopWatch.Stop()
+
+		requestID, _ := requestid.FromContext(r.Context())
+		logging.WithFields(logrus.Fields{
+			logfields.RequestId:  requestID,
+			logfields.RemoteAddr: r.RemoteAddr,
+			logfields.Request:    r.Method,
+			logfields.URI:        r.URL.RequestURI(),
+			logfields.StatusCode: recorder.status,
+			logfields.Elapsed:    stopWatch.Elapsed().Milliseconds(),
+		}).Info("request completed")
+	})
+}
+
+// TimeoutMiddleware sets a deadline of timeout on the request context.
+// If the handler returns after the deadline without writing a response
+// 503 Service Unavailable is returned with an errors.ErrorLog JSON body.
+// Unlike http.TimeoutHandler the response is not buffered, so
+// streaming works, but handlers must honor the context.
+func TimeoutMiddleware(timeout time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			recorder := newResponseRecorder(w)
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+			if ctx.Err() == context.DeadlineExceeded && !recorder.wroteHeader {
+				WriteError(recorder, r, &errors.ErrorLog{
+					RootCause:  "request timed out",
+					StatusCode: "503",
+					Err:        pkgerrors.Errorf("request did not complete within %v", timeout),
+				})
+			}
+		})
+	}
+}
+
+// BodyLimitMiddleware limits request bodies to maxBytes. Requests
+// declaring a larger Content-Length are rejected with 413 Request
+// Entity Too Large and an errors.ErrorLog JSON body, otherwise reading
+// past the limit returns an error to the handler.
+func BodyLimitMiddleware(maxBytes int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				WriteError(w, r, &errors.ErrorLog{
+					RootCause:  "request body too large",
+					StatusCode: "413",
+					Err:        pkgerrors.Errorf("request body exceeds %d bytes", maxBytes),
+				})
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type routerOptions struct {
+	requestIDHeader string
+	timeout         time.Duration
+	maxBodyBytes    int64
+	accessLog       bool
+	readyURLPath    string
+	liveURLPath     string
+	health          *HealthRegistry
+	recovery        []RecoveryOption
+	compress        []CompressOption
+	compression     bool
+	etags           bool
+	middlewares     []mux.MiddlewareFunc
+}
+
+// A RouterOption sets options for NewRouter
+type RouterOption func(*routerOptions)
+
+// WithRequestIDHeader is a RouterOption to set the request ID header,
+// defaults to DefaultRequestIDHeader
+func WithRequestIDHeader(header string) RouterOption {
+	return func(o *routerOptions) {
+		o.requestIDHeader = header
+	}
+}
+
+// WithRequestTimeout is a RouterOption to set the request timeout,
+// defaults to DefaultRequestTimeout, zero disables it
+func WithRequestTimeout(timeout time.Duration) RouterOption {
+	return func(o *routerOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithMaxBodyBytes is a RouterOption to set the request body limit,
+// defaults to DefaultMaxBodyBytes, zero disables it
+func WithMaxBodyBytes(maxBytes int64) RouterOption {
+	return func(o *routerOptions) {
+		o.maxBodyBytes = maxBytes
+	}
+}
+
+// WithoutAccessLog is a RouterOption to disable the access log
+func WithoutAccessLog() RouterOption {
+	return func(o *routerOptions) {
+		o.accessLog = false
+	}
+}
+
+// WithHealthURLPaths is a RouterOption to set the readiness and
+// liveness paths, defaults to DefaultReadyURLPath and DefaultLiveURLPath
+func WithHealthURLPaths(readyURLPath string, liveURLPath string) RouterOption {
+	return func(o *routerOptions) {
+		o.readyURLPath = readyURLPath
+		o.liveURLPath = liveURLPath
+	}
+}
+
+// WithHealthRegistry is a RouterOption to back the readiness endpoint
+// with a HealthRegistry, see CreateAndHandleReadinessLivenessWithHealth
+func WithHealthRegistry(registry *HealthRegistry) RouterOption {
+	return func(o *routerOptions) {
+		o.health = registry
+	}
+}
+
+// WithRecoveryOptions is a RouterOption to set the options of the
+// panic recovery middleware, such as WithRepanic in development
+func WithRecoveryOptions(recoveryOpts ...RecoveryOption) RouterOption {
+	return func(o *routerOptions) {
+		o.recovery = append(o.recovery, recoveryOpts...)
+	}
+}
+
+// WithCompression is a RouterOption to compress responses, see
+// CompressMiddleware
+func WithCompression(compressOpts ...CompressOption) RouterOption {
+	return func(o *routerOptions) {
+		o.compression = true
+		o.compress = append(o.compress, compressOpts...)
+	}
+}
+
+// WithETags is a RouterOption to add ETags and handle If-None-Match,
+// see ETagMiddleware
+func WithETags() RouterOption {
+	return func(o *routerOptions) {
+		o.etags = true
+	}
+}
+
+// WithMiddleware is a RouterOption to add middleware after the
+// standard stack
+func WithMiddleware(middlewares ...mux.MiddlewareFunc) RouterOption {
+	return func(o *routerOptions) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+// Router is a mux.Router for the service routes with the standard
+// middleware stack applied and the readiness and liveness endpoints
+// registered outside of it so probes are not access logged.
+type Router struct {
+	*mux.Router // register service routes here
+	Ready       UpdateFn
+	Live        UpdateFn
+	root        *mux.Router
+}
+
+// ServeHTTP serves the health endpoints and the service routes
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.root.ServeHTTP(w, req)
+}
+
+// NewRouter creates a Router with the standard middleware stack in
+// order: request ID, trace context, access log, compression, panic
+// recovery, body limit, request timeout and ETags, followed by any
+// WithMiddleware. Compression and ETags are only added when enabled.
+func NewRouter(opt ...RouterOption) *Router {
+	opts := routerOptions{
+		requestIDHeader: DefaultRequestIDHeader,
+		timeout:         DefaultRequestTimeout,
+		maxBodyBytes:    DefaultMaxBodyBytes,
+		accessLog:       true,
+		readyURLPath:    DefaultReadyURLPath,
+		liveURLPath:     DefaultLiveURLPath,
+	}
+	for _, o := range opt {
+		o(&opts)
+	}
+
+	root := mux.NewRouter()
+	router := &Router{root: root}
+	if opts.health != nil {
+		router.Ready, router.Live = CreateAndHandleReadinessLivenessWithHealth(root, opts.readyURLPath, opts.liveURLPath, opts.health)
+	} else {
+		router.Ready, router.Live = CreateAndHandleReadinessLiveness(root, opts.readyURLPath, opts.liveURLPath)
+	}
+
+	router.Router = root.PathPrefix("/").Subrouter()
+	router.Use(RequestIDMiddleware(opts.requestIDHeader), TraceContextMiddleware)
+	if opts.accessLog {
+		router.Use(AccessLogMiddleware)
+	}
+	if opts.compression {
+		router.Use(CompressMiddleware(opts.compress...))
+	}
+	router.Use(NewRecoveryMiddleware(opts.recovery...))
+	if opts.maxBodyBytes > 0 {
+		router.Use(BodyLimitMiddleware(opts.maxBodyBytes))
+	}
+	if opts.timeout > 0 {
+		router.Use(TimeoutMiddleware(opts.timeout))
+	}
+	if opts.etags {
+		router.Use(ETagMiddleware)
+	}
+	router.Use(opts.middlewares...)
+	return router
+}
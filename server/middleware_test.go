@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CodeNamor/Common/logging"
+	"github.com/CodeNamor/Common/requestclient"
+	"github.com/ascarter/requestid"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs redirects the default logger at info level to a buffer
+func captureLogs(t *testing.T) *bytes.Buffer {
+	buffer := &bytes.Buffer{}
+	loggerImpl := logging.DefaultLogger().LoggerImpl
+	out := loggerImpl.Out
+	level := loggerImpl.GetLevel()
+	loggerImpl.SetOutput(buffer)
+	logging.SetLevel(logging.InfoLevel)
+	t.Cleanup(func() {
+		loggerImpl.SetOutput(out)
+		loggerImpl.SetLevel(level)
+	})
+	return buffer
+}
+
+// decodeErrorBody decodes an ErrorLog JSON response body into a map
+func decodeErrorBody(t *testing.T, body []byte) map[string]string {
+	decoded := map[string]string{}
+	require.NoError(t, json.Unmarshal(body, &decoded), string(body))
+	return decoded
+}
+
+func Test_RequestIDMiddleware(t *testing.T) {
+	var gotID string
+	handler := RequestIDMiddleware("X-Correlation-ID")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID, _ = requestid.FromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Correlation-ID", "abc")
+	handler.ServeHTTP(w, req)
+	require.Equal(t, "abc", gotID)
+	require.Equal(t, "abc", w.Header().Get("X-Correlation-ID"))
+
+	for _, inbound := range []string{"", strings.Repeat("a", MaxRequestIDLength+1), "abc\x1b[31m", "abc def", "<script>"} {
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Correlation-ID", inbound)
+		handler.ServeHTTP(w, req)
+		require.Len(t, gotID, 36, "%q is regenerated", inbound)
+		require.Equal(t, gotID, w.Header().Get("X-Correlation-ID"))
+		require.Equal(t, gotID, req.Header.Get("X-Correlation-ID"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Correlation-ID", strings.Repeat("a", MaxRequestIDLength))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.Equal(t, strings.Repeat("a", MaxRequestIDLength), gotID)
+}
+
+func Test_TraceContextMiddleware(t *testing.T) {
+	var got requestclient.TraceContext
+	handler := TraceContextMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = requestclient.TraceContextFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", got.TraceIDString())
+	require.Equal(t, "vendor=1", got.State)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", got.TraceIDString())
+}
+
+func Test_TimeoutMiddleware(t *testing.T) {
+	handler := TimeoutMiddleware(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "request timed out", decodeErrorBody(t, w.Body.Bytes())["RootCause"])
+
+	fast := TimeoutMiddleware(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	w = httptest.NewRecorder()
+	fast.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "ok", w.Body.String())
+}
+
+func Test_BodyLimitMiddleware(t *testing.T) {
+	handler := BodyLimitMiddleware(4)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345")))
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader("12345")))
+	req.ContentLength = -1 // unknown length is limited while reading
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("1234")))
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func Test_NewRouter(t *testing.T) {
+	logs := captureLogs(t)
+	router := NewRouter()
+	router.HandleFunc("/widgets", DefaultHandler(func(w http.ResponseWriter, r *http.Request) {
+		requestID, _ := requestid.FromContext(r.Context())
+		w.Write([]byte(`{"requestId":"` + requestID + `"}`))
+	}))
+	router.Ready(true)
+	router.Live(true)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/widgets", nil)
+	req.Header.Set(DefaultRequestIDHeader, "rid-9")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, `{"requestId":"rid-9"}`, w.Body.String())
+	require.Contains(t, logs.String(), "request completed")
+	require.Contains(t, logs.String(), "uri=/widgets")
+
+	logs.Reset()
+	for _, path := range []string{DefaultReadyURLPath, DefaultLiveURLPath} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	require.Empty(t, logs.String(), "health probes are not access logged")
+}
@@ -0,0 +1,412 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CodeNamor/Common/errors"
+)
+
+// OpenAPIVersion is the version of the documents created by OpenAPI
+const OpenAPIVersion = "3.0.3"
+
+// OpenAPIInfo is the info object of an OpenAPI document
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// RouteDoc annotates a named route for the OpenAPI document. Request
+// and Response are values of the Go types of the JSON bodies, such as
+// CreateWidgetRequest{}, their schemas are created from the json tags
+// with descriptions from `doc` tags and required fields from
+// `validate:"required"` tags.
+type RouteDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Request     interface{}
+	Response    interface{}
+	Status      int // success status, defaults to 200
+}
+
+// OpenAPIDocument is an OpenAPI 3 document
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+// OpenAPIComponents holds the named schemas
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// OpenAPIOperation is an operation on a path
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter is a path or query parameter
+type OpenAPIParameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// OpenAPIRequestBody is a JSON request body
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse is a response, with a JSON body if Content is set
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType holds the schema of a body
+type OpenAPIMediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is a JSON schema as used by OpenAPI 3
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+// OpenAPI creates an OpenAPI 3 skeleton document from the routes of
+// router. docs annotates routes by their mux route name, which is also
+// used as the operationId. Routes without methods are documented as
+// GET. Path variables and the Queries of a route are parameters. Every operation has a default error response with the
+// errors.ErrorLog schema written by WriteError.
+func OpenAPI(router Walker, info OpenAPIInfo, docs map[string]RouteDoc) (*OpenAPIDocument, error) {
+	routes, err := Routes(router)
+	if err != nil {
+		return nil, err
+	}
+	generator := &schemaGenerator{schemas: map[string]*Schema{}, names: map[reflect.Type]string{}}
+	errorSchema := generator.schemaOf(reflect.TypeOf(errors.ErrorLog{}))
+
+	document := &OpenAPIDocument{
+		OpenAPI:    OpenAPIVersion,
+		Info:       info,
+		Paths:      map[string]map[string]*OpenAPIOperation{},
+		Components: OpenAPIComponents{Schemas: generator.schemas},
+	}
+	for _, route := range routes {
+		path, parameters := openAPIPath(route.PathTemplate)
+		parameters = append(parameters, queryParameters(route.Queries)...)
+		if len(parameters) == 0 {
+			parameters = nil
+		}
+		methods := route.Methods
+		if len(methods) == 0 {
+			methods = []string{http.MethodGet}
+		}
+		if document.Paths[path] == nil {
+			document.Paths[path] = map[string]*OpenAPIOperation{}
+		}
+
+		doc := docs[route.Name]
+		for _, method := range methods {
+			operation := &OpenAPIOperation{
+				OperationID: route.Name,
+				Summary:     doc.Summary,
+				Description: doc.Description,
+				Tags:        doc.Tags,
+				Parameters:  parameters,
+				Responses: map[string]*OpenAPIResponse{
+					"default": {Description: "error", Content: jsonContent(errorSchema)},
+				},
+			}
+			if len(methods) > 1 && route.Name != "" {
+				operation.OperationID = route.Name + method[:1] + strings.ToLower(method[1:])
+			}
+			if doc.Request != nil {
+				operation.RequestBody = &OpenAPIRequestBody{
+					Required: true,
+					Content:  jsonContent(generator.schemaOf(reflect.TypeOf(doc.Request))),
+				}
+			}
+			status := doc.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			success := &OpenAPIResponse{Description: http.StatusText(status)}
+			if doc.Response != nil {
+				success.Content = jsonContent(generator.schemaOf(reflect.TypeOf(doc.Response)))
+			}
+			operation.Responses[strconv.Itoa(status)] = success
+			document.Paths[path][strings.ToLower(method)] = operation
+		}
+	}
+	return document, nil
+}
+
+// OpenAPIHandler serves the JSON OpenAPI document of router
+func OpenAPIHandler(router Walker, info OpenAPIInfo, docs map[string]RouteDoc) http.HandlerFunc {
+	return DefaultHandler(func(w http.ResponseWriter, _ *http.Request) {
+		document, err := OpenAPI(router, info, docs)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(document)
+	})
+}
+
+// templateVariable is a {name} or {name:pattern} variable of a mux
+// template, from start up to end
+type templateVariable struct {
+	name       string
+	pattern    string
+	start, end int
+}
+
+// templateVariables returns the variables of a mux template, counting
+// the depth of braces as mux does so patterns such as [0-9]{3} can
+// contain them
+func templateVariables(template string) []templateVariable {
+	variables := []templateVariable{}
+	depth, start := 0, 0
+	for i := 0; i < len(template); i++ {
+		switch template[i] {
+		case '{':
+			if depth++; depth == 1 {
+				start = i
+			}
+		case '}':
+			if depth--; depth == 0 {
+				parts := strings.SplitN(template[start+1:i], ":", 2)
+				variable := templateVariable{name: strings.TrimSpace(parts[0]), start: start, end: i + 1}
+				if len(parts) == 2 {
+					variable.pattern = parts[1]
+				}
+				variables = append(variables, variable)
+			}
+		}
+	}
+	return variables
+}
+
+// openAPIPath converts a mux path template to an OpenAPI path and its
+// path parameters
+func openAPIPath(pathTemplate string) (string, []OpenAPIParameter) {
+	parameters := []OpenAPIParameter{}
+	path := strings.Builder{}
+	last := 0
+	for _, variable := range templateVariables(pathTemplate) {
+		schema := &Schema{Type: "string"}
+		if variable.pattern != "" {
+			schema.Pattern = "^" + variable.pattern + "$"
+		}
+		parameters = append(parameters, OpenAPIParameter{Name: variable.name, In: "path", Required: true, Schema: schema})
+		path.WriteString(pathTemplate[last:variable.start] + "{" + variable.name + "}")
+		last = variable.end
+	}
+	path.WriteString(pathTemplate[last:])
+	return path.String(), parameters
+}
+
+// queryParameters converts the key=value query templates of a route to
+// required query parameters, the value is a pattern unless it matches
+// anything
+func queryParameters(queries []string) []OpenAPIParameter {
+	parameters := []OpenAPIParameter{}
+	for _, query := range queries {
+		parts := strings.SplitN(query, "=", 2)
+		schema := &Schema{Type: "string"}
+		if len(parts) == 2 && parts[1] != "" {
+			pattern := strings.Builder{}
+			last := 0
+			for _, variable := range templateVariables(parts[1]) {
+				pattern.WriteString(regexp.QuoteMeta(parts[1][last:variable.start]))
+				if variable.pattern != "" {
+					pattern.WriteString("(?:" + variable.pattern + ")")
+				} else {
+					pattern.WriteString(".*")
+				}
+				last = variable.end
+			}
+			pattern.WriteString(regexp.QuoteMeta(parts[1][last:]))
+			if pattern.String() != ".*" {
+				schema.Pattern = "^" + pattern.String() + "$"
+			}
+		}
+		parameters = append(parameters, OpenAPIParameter{Name: parts[0], In: "query", Required: true, Schema: schema})
+	}
+	return parameters
+}
+
+func jsonContent(schema *Schema) map[string]OpenAPIMediaType {
+	return map[string]OpenAPIMediaType{ContentTypeJSON: {Schema: schema}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaGenerator creates schemas from Go types, adding named structs
+// to schemas and referencing them
+type schemaGenerator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+// schemaName returns the name of the schema of t, the type name unless
+// a type from another package already has it, then it is qualified
+// with the package path
+func (g *schemaGenerator) schemaName(t reflect.Type) (string, bool) {
+	if name, exists := g.names[t]; exists {
+		return name, true
+	}
+	name := t.Name()
+	qualified := strings.ReplaceAll(t.PkgPath(), "/", ".") + "." + t.Name()
+	for i := 1; ; i++ {
+		if _, taken := g.schemas[name]; !taken {
+			break
+		}
+		name = qualified
+		if i > 1 {
+			name += strconv.Itoa(i) // types declared in functions
+		}
+	}
+	g.names[t] = name
+	return name, false
+}
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var schema *Schema
+	switch {
+	case t == timeType:
+		schema = &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		name, exists := g.schemaName(t)
+		if !exists {
+			g.schemas[name] = &Schema{} // placeholder for recursive types
+			g.schemas[name] = g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	case t.Kind() == reflect.Struct:
+		schema = g.structSchema(t)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		schema = &Schema{Type: "string", Format: "byte"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		schema = &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case t.Kind() == reflect.Map:
+		schema = &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case t.Kind() == reflect.Bool:
+		schema = &Schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema = &Schema{Type: "integer"}
+		if t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64 {
+			schema.Format = "int64"
+		} else if t.Kind() == reflect.Int32 || t.Kind() == reflect.Uint32 {
+			schema.Format = "int32"
+		}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = &Schema{Type: "number"}
+	case t.Kind() == reflect.String:
+		schema = &Schema{Type: "string"}
+	default:
+		schema = &Schema{} // interface{} and others allow any value
+	}
+	schema.Nullable = nullable
+	return schema
+}
+
+// structSchema creates an object schema from the exported fields,
+// flattening embedded structs as encoding/json does
+func (g *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, omitted := jsonFieldName(field)
+		if omitted {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				flattened := g.structSchema(embedded)
+				for propertyName, property := range flattened.Properties {
+					schema.Properties[propertyName] = property
+				}
+				schema.Required = append(schema.Required, flattened.Required...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schemaOf(field.Type)
+		if description := field.Tag.Get("doc"); description != "" {
+			if property.Ref != "" {
+				property = &Schema{Ref: property.Ref} // siblings of $ref are ignored in OpenAPI 3.0
+			} else {
+				property.Description = description
+			}
+		}
+		schema.Properties[name] = property
+		if hasValidateRule(field, "required") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+// jsonFieldName returns the json tag name, or omitted for "-"
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	return strings.Split(tag, ",")[0], false
+}
+
+// hasValidateRule reports whether the validate tag contains rule
+func hasValidateRule(field reflect.StructField, rule string) bool {
+	for _, candidate := range strings.Split(field.Tag.Get("validate"), ",") {
+		if strings.TrimSpace(strings.SplitN(candidate, "=", 2)[0]) == rule {
+			return true
+		}
+	}
+	return false
+}
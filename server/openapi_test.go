@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+type testAudit struct {
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type testWidget struct {
+	testAudit
+	ID       int64             `json:"id" doc:"widget identifier"`
+	Name     string            `json:"name" validate:"required,max=40"`
+	Price    *float64          `json:"price,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Parent   *testWidget       `json:"parent,omitempty"`
+	internal string
+	Ignored  string `json:"-"`
+}
+
+type testCreateWidget struct {
+	Name string `json:"name" validate:"required"`
+}
+
+func Test_OpenAPI(t *testing.T) {
+	router := mux.NewRouter()
+	noop := func(http.ResponseWriter, *http.Request) {}
+	router.HandleFunc("/widgets", noop).Methods(http.MethodPost).Name("createWidget")
+	router.HandleFunc("/widgets/{id:[0-9]+}", noop).Methods(http.MethodGet, http.MethodPut).Name("widget")
+	router.HandleFunc("/ping", noop)
+
+	document, err := OpenAPI(router, OpenAPIInfo{Title: "widgets", Version: "1.0.0"}, map[string]RouteDoc{
+		"createWidget": {Summary: "Create a widget", Tags: []string{"widgets"}, Request: testCreateWidget{}, Response: &testWidget{}, Status: http.StatusCreated},
+		"widget":       {Response: testWidget{}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, OpenAPIVersion, document.OpenAPI)
+
+	create := document.Paths["/widgets"]["post"]
+	require.Equal(t, "createWidget", create.OperationID)
+	require.Equal(t, "Create a widget", create.Summary)
+	require.Equal(t, "#/components/schemas/testCreateWidget", create.RequestBody.Content[ContentTypeJSON].Schema.Ref)
+	require.Equal(t, "#/components/schemas/testWidget", create.Responses["201"].Content[ContentTypeJSON].Schema.Ref)
+	require.Equal(t, "#/components/schemas/ErrorLog", create.Responses["default"].Content[ContentTypeJSON].Schema.Ref)
+
+	get := document.Paths["/widgets/{id}"]["get"]
+	require.Equal(t, "widgetGet", get.OperationID)
+	require.Equal(t, []OpenAPIParameter{{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string", Pattern: "^[0-9]+$"}}}, get.Parameters)
+	require.Equal(t, "widgetPut", document.Paths["/widgets/{id}"]["put"].OperationID)
+	require.NotNil(t, document.Paths["/ping"]["get"].Responses["200"], "routes without methods are GET")
+
+	widget := document.Components.Schemas["testWidget"]
+	require.Equal(t, []string{"name"}, widget.Required)
+	require.Equal(t, &Schema{Type: "string", Format: "date-time"}, widget.Properties["createdAt"], "embedded fields are flattened")
+	require.Equal(t, &Schema{Type: "integer", Format: "int64", Description: "widget identifier"}, widget.Properties["id"])
+	require.Equal(t, &Schema{Type: "number", Nullable: true}, widget.Properties["price"])
+	require.Equal(t, &Schema{Type: "array", Items: &Schema{Type: "string"}}, widget.Properties["tags"])
+	require.Equal(t, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}}, widget.Properties["labels"])
+	require.Equal(t, "#/components/schemas/testWidget", widget.Properties["parent"].Ref, "recursive types are referenced")
+	require.NotContains(t, widget.Properties, "internal")
+	require.NotContains(t, widget.Properties, "Ignored")
+	require.Contains(t, document.Components.Schemas["ErrorLog"].Properties, "RootCause")
+
+	w := httptest.NewRecorder()
+	OpenAPIHandler(router, OpenAPIInfo{Title: "widgets", Version: "1.0.0"}, nil)(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	served := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &served))
+	require.Equal(t, OpenAPIVersion, served["openapi"])
+}
+
+func Test_OpenAPI_Parameters(t *testing.T) {
+	router := mux.NewRouter()
+	noop := func(http.ResponseWriter, *http.Request) {}
+	router.HandleFunc("/items/{id:[0-9]{3}}/{part}", noop).Queries("page", "{page:[0-9]+}", "sort", "{sort}", "v", "v{n}").Name("item")
+
+	document, err := OpenAPI(router, OpenAPIInfo{Title: "items", Version: "1.0.0"}, nil)
+	require.NoError(t, err)
+	require.Contains(t, document.Paths, "/items/{id}/{part}")
+	require.Equal(t, []OpenAPIParameter{
+		{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "string", Pattern: "^[0-9]{3}$"}},
+		{Name: "part", In: "path", Required: true, Schema: &Schema{Type: "string"}},
+		{Name: "page", In: "query", Required: true, Schema: &Schema{Type: "string", Pattern: "^(?:[0-9]+)$"}},
+		{Name: "sort", In: "query", Required: true, Schema: &Schema{Type: "string"}},
+		{Name: "v", In: "query", Required: true, Schema: &Schema{Type: "string", Pattern: "^v.*$"}},
+	}, document.Paths["/items/{id}/{part}"]["get"].Parameters)
+}
+
+func Test_OpenAPI_SchemaNameCollision(t *testing.T) {
+	type ErrorLog struct {
+		Local string `json:"local"`
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/logs", func(http.ResponseWriter, *http.Request) {}).Name("logs")
+
+	document, err := OpenAPI(router, OpenAPIInfo{Title: "logs", Version: "1.0.0"}, map[string]RouteDoc{
+		"logs": {Response: ErrorLog{}},
+	})
+	require.NoError(t, err)
+	ref := document.Paths["/logs"]["get"].Responses["200"].Content[ContentTypeJSON].Schema.Ref
+	require.Equal(t, "#/components/schemas/github.com.CodeNamor.Common.server.ErrorLog", ref)
+	require.Contains(t, document.Components.Schemas["github.com.CodeNamor.Common.server.ErrorLog"].Properties, "local")
+	require.Contains(t, document.Components.Schemas["ErrorLog"].Properties, "RootCause")
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Defaults applied to the http.Server by ListenAndServeWithOptions
+// unless overridden with an Option
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultWriteTimeout      = 60 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+	DefaultMaxHeaderBytes    = 1 << 20 // 1 MB
+	DefaultShutdownTimeout   = 20 * time.Second
+)
+
+// ShutdownHook is run during graceful shutdown after the server has
+// stopped accepting requests, such as closing DB pools or flushing logs.
+// ctx is cancelled when the shutdown deadline passes.
+type ShutdownHook func(ctx context.Context) error
+
+type namedShutdownHook struct {
+	name string
+	hook ShutdownHook
+}
+
+type options struct {
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+
+	readinessFn     UpdateFn
+	preStopDelay    time.Duration
+	shutdownTimeout time.Duration
+	shutdownHooks   []namedShutdownHook
+
+	tls       *tlsOptions // nil serves plaintext HTTP
+	h2c       bool
+	listeners []ListenerConfig
+
+	adminAddr    string // empty disables the admin listener
+	adminHandler http.Handler
+}
+
+func defaultOptions() options {
+	return options{
+		readHeaderTimeout: DefaultReadHeaderTimeout,
+		readTimeout:       DefaultReadTimeout,
+		writeTimeout:      DefaultWriteTimeout,
+		idleTimeout:       DefaultIdleTimeout,
+		maxHeaderBytes:    DefaultMaxHeaderBytes,
+		shutdownTimeout:   DefaultShutdownTimeout,
+	}
+}
+
+// A Option sets options such as timeouts and limits on the server
+type Option func(*options)
+
+// WithReadHeaderTimeout is an Option to set the amount of time allowed
+// to read request headers, this is the main protection against
+// slowloris style attacks. Zero means no timeout.
+func WithReadHeaderTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.readHeaderTimeout = timeout
+	}
+}
+
+// WithReadTimeout is an Option to set the maximum duration for reading
+// the entire request, including the body. Zero means no timeout.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = timeout
+	}
+}
+
+// WithWriteTimeout is an Option to set the maximum duration before
+// timing out writes of the response. Zero means no timeout, which may
+// be needed for streaming responses.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = timeout
+	}
+}
+
+// WithIdleTimeout is an Option to set the maximum amount of time to
+// wait for the next request when keep-alives are enabled. Zero means
+// the ReadTimeout is used.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithMaxHeaderBytes is an Option to set the maximum number of bytes
+// the server will read parsing the request headers
+func WithMaxHeaderBytes(maxBytes int) Option {
+	return func(o *options) {
+		o.maxHeaderBytes = maxBytes
+	}
+}
+
+// WithReadinessFn is an Option to set the readiness UpdateFn, such as
+// the one returned from CreateAndHandleReadinessLiveness, which is set
+// to false as soon as shutdown begins
+func WithReadinessFn(readinessFn UpdateFn) Option {
+	return func(o *options) {
+		o.readinessFn = readinessFn
+	}
+}
+
+// WithPreStopDelay is an Option to set how long to keep serving after
+// readiness is set to false, giving load balancers time to deregister
+// the pod before connections are drained. Defaults to zero.
+func WithPreStopDelay(delay time.Duration) Option {
+	return func(o *options) {
+		o.preStopDelay = delay
+	}
+}
+
+// WithShutdownTimeout is an Option to set the hard deadline for
+// draining connections, after which remaining connections are closed.
+// The shutdown hooks are given the same amount of time to complete.
+// Defaults to DefaultShutdownTimeout, zero means no deadline.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.shutdownTimeout = timeout
+	}
+}
+
+// WithShutdownHook is an Option to register a hook which is run after
+// the server has shut down. Hooks run in the reverse order they were
+// registered, so resources are released in the opposite order to
+// their creation.
+func WithShutdownHook(name string, hook ShutdownHook) Option {
+	return func(o *options) {
+		o.shutdownHooks = append(o.shutdownHooks, namedShutdownHook{name: name, hook: hook})
+	}
+}
+
+// WithAdminListener is an Option to serve handler, such as one from
+// NewAdminHandler, on a separate internal only address like
+// "127.0.0.1:6060" alongside the main server. It shares the graceful
+// shutdown of the main server and has no write timeout so profiles
+// can be collected.
+func WithAdminListener(addr string, handler http.Handler) Option {
+	return func(o *options) {
+		o.adminAddr = addr
+		o.adminHandler = handler
+	}
+}
+
+// withoutLimits is an Option to clear the timeouts, limits and shutdown
+// deadline, leaving the http.Server defaults ListenAndServe has always
+// used
+func withoutLimits() Option {
+	return func(o *options) {
+		o.readHeaderTimeout = 0
+		o.readTimeout = 0
+		o.writeTimeout = 0
+		o.idleTimeout = 0
+		o.maxHeaderBytes = 0
+		o.shutdownTimeout = 0
+	}
+}
+
+// newOptions applies opt over the defaults
+func newOptions(opt ...Option) *options {
+	opts := defaultOptions()
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &opts
+}
+
+// newHTTPServer creates an http.Server configured from opts
+func newHTTPServer(addr string, handler http.Handler, opts *options) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: opts.readHeaderTimeout,
+		ReadTimeout:       opts.readTimeout,
+		WriteTimeout:      opts.writeTimeout,
+		IdleTimeout:       opts.idleTimeout,
+		MaxHeaderBytes:    opts.maxHeaderBytes,
+	}
+}
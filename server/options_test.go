@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newHTTPServer(t *testing.T) {
+	handler := http.NotFoundHandler()
+
+	t.Run("defaults", func(t *testing.T) {
+		srv := newHTTPServer(":8080", handler, newOptions())
+		require.Equal(t, ":8080", srv.Addr)
+		require.Equal(t, DefaultReadHeaderTimeout, srv.ReadHeaderTimeout)
+		require.Equal(t, DefaultReadTimeout, srv.ReadTimeout)
+		require.Equal(t, DefaultWriteTimeout, srv.WriteTimeout)
+		require.Equal(t, DefaultIdleTimeout, srv.IdleTimeout)
+		require.Equal(t, DefaultMaxHeaderBytes, srv.MaxHeaderBytes)
+	})
+
+	t.Run("options override defaults", func(t *testing.T) {
+		srv := newHTTPServer(":8080", handler, newOptions(
+			WithReadHeaderTimeout(time.Second),
+			WithReadTimeout(2*time.Second),
+			WithWriteTimeout(0),
+			WithIdleTimeout(4*time.Second),
+			WithMaxHeaderBytes(4096),
+		))
+		require.Equal(t, time.Second, srv.ReadHeaderTimeout)
+		require.Equal(t, 2*time.Second, srv.ReadTimeout)
+		require.Equal(t, time.Duration(0), srv.WriteTimeout)
+		require.Equal(t, 4*time.Second, srv.IdleTimeout)
+		require.Equal(t, 4096, srv.MaxHeaderBytes)
+	})
+
+	t.Run("ListenAndServe has no limits", func(t *testing.T) {
+		opts := newOptions(withoutLimits())
+		srv := newHTTPServer(":8080", handler, opts)
+		require.Equal(t, time.Duration(0), srv.ReadHeaderTimeout)
+		require.Equal(t, time.Duration(0), srv.ReadTimeout)
+		require.Equal(t, time.Duration(0), srv.WriteTimeout)
+		require.Equal(t, time.Duration(0), srv.IdleTimeout)
+		require.Equal(t, 0, srv.MaxHeaderBytes)
+		require.Equal(t, time.Duration(0), opts.shutdownTimeout)
+	})
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CodeNamor/Common/errors"
+	"github.com/gorilla/mux"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// rateLimitedCount and loadShedCount are the requests rejected by all
+// rate limiting and load shedding middleware
+var (
+	rateLimitedCount uint64
+	loadShedCount    uint64
+)
+
+// RateLimitedCount returns the number of requests rejected with 429 by
+// RateLimiter middleware since the process started
+func RateLimitedCount() uint64 {
+	return atomic.LoadUint64(&rateLimitedCount)
+}
+
+// LoadShedCount returns the number of requests rejected with 503 by
+// ConcurrencyLimiter and AdaptiveLimiter middleware since the process
+// started
+func LoadShedCount() uint64 {
+	return atomic.LoadUint64(&loadShedCount)
+}
+
+// KeyFunc returns the client key a request is rate limited by
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP keys by the remote IP address. Behind a proxy use
+// KeyByHeader with the header the proxy sets instead.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader keys by the value of header, such as DefaultAPIKeyHeader,
+// falling back to KeyByIP when it is missing
+func KeyByHeader(header string) KeyFunc {
+	return func(r *http.Request) string {
+		if value := r.Header.Get(header); value != "" {
+			return header + ":" + value
+		}
+		return KeyByIP(r)
+	}
+}
+
+// KeyByPrincipal keys by the subject of the Principal set by
+// AuthMiddleware, falling back to KeyByIP for anonymous requests
+func KeyByPrincipal(r *http.Request) string {
+	if principal, ok := PrincipalFromContext(r.Context()); ok {
+		return principal.Method + ":" + principal.Subject
+	}
+	return KeyByIP(r)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is a token bucket rate limiter per client key. Buckets
+// which would have refilled are removed, so memory is bounded by the
+// number of recently active clients.
+type RateLimiter struct {
+	rate      float64 // tokens per second
+	burst     float64
+	keyFunc   KeyFunc
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewRateLimiter creates a RateLimiter allowing each client rate
+// requests per second on average with bursts of up to burst requests,
+// keyed by keyFunc, which defaults to KeyByIP when nil. The rate must
+// be positive.
+func NewRateLimiter(rate float64, burst int, keyFunc KeyFunc) (*RateLimiter, error) {
+	if !(rate > 0) || math.IsInf(rate, 1) {
+		return nil, pkgerrors.Errorf("rate limiter rate must be positive, got %v", rate)
+	}
+	if keyFunc == nil {
+		keyFunc = KeyByIP
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		keyFunc: keyFunc,
+		buckets: map[string]*tokenBucket{},
+		now:     time.Now,
+	}, nil
+}
+
+// Allow takes a token for key, if none is available it returns false
+// and how long until one will be
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	now := l.now()
+	refillTime := time.Duration(l.burst / l.rate * float64(time.Second))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > refillTime {
+		for bucketKey, bucket := range l.buckets {
+			if now.Sub(bucket.last) > refillTime {
+				delete(l.buckets, bucketKey) // full again, same as a new bucket
+			}
+		}
+		l.lastSweep = now
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// Middleware returns middleware rejecting requests over the limit
+// with 429 Too Many Requests, a Retry-After header and an
+// errors.ErrorLog JSON body
+func (l *RateLimiter) Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, retryAfter := l.Allow(l.keyFunc(r))
+			if !allowed {
+				atomic.AddUint64(&rateLimitedCount, 1)
+				writeLimited(w, r, http.StatusTooManyRequests, retryAfter, "RateLimited", "too many requests")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ConcurrencyLimiter sheds load by rejecting requests once max are
+// already in flight
+type ConcurrencyLimiter struct {
+	slots chan struct{}
+}
+
+// NewConcurrencyLimiter creates a ConcurrencyLimiter allowing max
+// requests in flight, max must be at least 1
+func NewConcurrencyLimiter(max int) (*ConcurrencyLimiter, error) {
+	if max < 1 {
+		return nil, pkgerrors.Errorf("concurrency limiter max must be at least 1, got %d", max)
+	}
+	return &ConcurrencyLimiter{slots: make(chan struct{}, max)}, nil
+}
+
+// InFlight returns the number of requests in flight
+func (l *ConcurrencyLimiter) InFlight() int {
+	return len(l.slots)
+}
+
+// Middleware returns middleware rejecting requests over the limit with
+// 503 Service Unavailable, a Retry-After header and an errors.ErrorLog
+// JSON body
+func (l *ConcurrencyLimiter) Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case l.slots <- struct{}{}:
+			default:
+				atomic.AddUint64(&loadShedCount, 1)
+				writeLimited(w, r, http.StatusServiceUnavailable, time.Second, "Overloaded", "server overloaded")
+				return
+			}
+			defer func() { <-l.slots }()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AdaptiveLimiterConfig configures an AdaptiveLimiter
+type AdaptiveLimiterConfig struct {
+	MinLimit      int           // never limits below this, defaults to 1
+	MaxLimit      int           // never allows more in flight than this
+	InitialLimit  int           // defaults to MaxLimit
+	TargetLatency time.Duration // requests slower than this lower the limit
+	Backoff       float64       // multiplier applied on slow requests, defaults to 0.9
+}
+
+// AdaptiveLimiter is a concurrency limit adjusted from observed latency
+// using additive increase, multiplicative decrease: every request
+// completing within the target latency raises the limit by 1/limit,
+// about one per limit's worth of requests, and every slower request
+// multiplies it by the backoff
+type AdaptiveLimiter struct {
+	config   AdaptiveLimiterConfig
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	now      func() time.Time
+}
+
+// NewAdaptiveLimiter creates an AdaptiveLimiter from config
+func NewAdaptiveLimiter(config AdaptiveLimiterConfig) (*AdaptiveLimiter, error) {
+	if config.MinLimit < 1 {
+		config.MinLimit = 1
+	}
+	if config.MaxLimit < config.MinLimit {
+		return nil, pkgerrors.New("adaptive limiter MaxLimit must be at least MinLimit")
+	}
+	if config.TargetLatency <= 0 {
+		return nil, pkgerrors.New("adaptive limiter requires a TargetLatency")
+	}
+	if config.InitialLimit < config.MinLimit || config.InitialLimit > config.MaxLimit {
+		config.InitialLimit = config.MaxLimit
+	}
+	if config.Backoff <= 0 || config.Backoff >= 1 {
+		config.Backoff = 0.9
+	}
+	return &AdaptiveLimiter{
+		config: config,
+		limit:  float64(config.InitialLimit),
+		now:    time.Now,
+	}, nil
+}
+
+// Limit returns the current concurrency limit
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *AdaptiveLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+func (l *AdaptiveLimiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if latency > l.config.TargetLatency {
+		l.limit = math.Max(float64(l.config.MinLimit), l.limit*l.config.Backoff)
+	} else {
+		l.limit = math.Min(float64(l.config.MaxLimit), l.limit+1/l.limit)
+	}
+}
+
+// Middleware returns middleware rejecting requests over the current
+// limit with 503 Service Unavailable, a Retry-After header and an
+// errors.ErrorLog JSON body
+func (l *AdaptiveLimiter) Middleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.acquire() {
+				atomic.AddUint64(&loadShedCount, 1)
+				writeLimited(w, r, http.StatusServiceUnavailable, time.Second, "Overloaded", "server overloaded")
+				return
+			}
+			start := l.now()
+			defer func() { l.release(l.now().Sub(start)) }()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeLimited writes a rejected request response with the Retry-After
+// header rounded up to whole seconds. It is not logged, which would
+// add to the load, the counters are incremented instead.
+func writeLimited(w http.ResponseWriter, r *http.Request, status int, retryAfter time.Duration, exceptionType string, rootCause string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	WriteError(w, r, &errors.ErrorLog{
+		RootCause:     rootCause,
+		StatusCode:    strconv.Itoa(status),
+		ExceptionType: exceptionType,
+		Err:           pkgerrors.Errorf("retry after %d seconds", seconds),
+	}, WithoutLogging())
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RateLimiter_Allow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter, err := NewRateLimiter(2, 3, nil)
+	require.NoError(t, err)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow("a")
+		require.True(t, allowed, "burst %d", i)
+	}
+	allowed, retryAfter := limiter.Allow("a")
+	require.False(t, allowed)
+	require.Equal(t, 500*time.Millisecond, retryAfter)
+
+	allowed, _ = limiter.Allow("b")
+	require.True(t, allowed, "keys have separate buckets")
+
+	now = now.Add(500 * time.Millisecond)
+	allowed, _ = limiter.Allow("a")
+	require.True(t, allowed, "refilled one token")
+
+	now = now.Add(time.Hour)
+	limiter.Allow("c")
+	require.Len(t, limiter.buckets, 1, "idle buckets are removed")
+}
+
+func Test_NewRateLimiter_InvalidRate(t *testing.T) {
+	for _, rate := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		limiter, err := NewRateLimiter(rate, 1, nil)
+		require.Error(t, err, "rate %v", rate)
+		require.Nil(t, limiter)
+	}
+}
+
+func Test_NewConcurrencyLimiter_InvalidMax(t *testing.T) {
+	for _, max := range []int{0, -1} {
+		limiter, err := NewConcurrencyLimiter(max)
+		require.Error(t, err, "max %d", max)
+		require.Nil(t, limiter)
+	}
+}
+
+func Test_RateLimiter_Middleware(t *testing.T) {
+	limiter, err := NewRateLimiter(1, 1, KeyByHeader(DefaultAPIKeyHeader))
+	require.NoError(t, err)
+	handler := limiter.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	before := RateLimitedCount()
+
+	request := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(DefaultAPIKeyHeader, key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	require.Equal(t, http.StatusOK, request("k1").Code)
+	w := request("k1")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "1", w.Header().Get("Retry-After"))
+	require.Equal(t, "RateLimited", decodeErrorBody(t, w.Body.Bytes())["ExceptionType"])
+	require.Equal(t, http.StatusOK, request("k2").Code)
+	require.Equal(t, before+1, RateLimitedCount())
+}
+
+func Test_KeyFuncs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.1.2.3:5555"
+	require.Equal(t, "10.1.2.3", KeyByIP(req))
+	require.Equal(t, "10.1.2.3", KeyByHeader("X-Client")(req))
+	require.Equal(t, "10.1.2.3", KeyByPrincipal(req))
+
+	req.Header.Set("X-Client", "c1")
+	require.Equal(t, "X-Client:c1", KeyByHeader("X-Client")(req))
+
+	req = req.WithContext(ContextWithPrincipal(req.Context(), &Principal{Subject: "user-1", Method: AuthMethodJWT}))
+	require.Equal(t, "jwt:user-1", KeyByPrincipal(req))
+}
+
+func Test_ConcurrencyLimiter(t *testing.T) {
+	limiter, err := NewConcurrencyLimiter(2)
+	require.NoError(t, err)
+	release := make(chan struct{})
+	started := sync.WaitGroup{}
+	handler := limiter.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started.Done()
+		<-release
+	}))
+	before := LoadShedCount()
+
+	done := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		started.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+	}
+	started.Wait()
+	require.Equal(t, 2, limiter.InFlight())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "1", w.Header().Get("Retry-After"))
+	require.Equal(t, before+1, LoadShedCount())
+
+	close(release)
+	done.Wait()
+	require.Equal(t, 0, limiter.InFlight())
+}
+
+func Test_AdaptiveLimiter(t *testing.T) {
+	_, err := NewAdaptiveLimiter(AdaptiveLimiterConfig{MaxLimit: 10})
+	require.Error(t, err)
+
+	limiter, err := NewAdaptiveLimiter(AdaptiveLimiterConfig{MinLimit: 2, MaxLimit: 10, TargetLatency: 100 * time.Millisecond, Backoff: 0.5})
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+	latency := 200 * time.Millisecond
+	handler := limiter.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now = now.Add(latency)
+	}))
+	serve := func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	require.Equal(t, 10, limiter.Limit())
+	serve()
+	require.Equal(t, 5, limiter.Limit(), "slow requests back off")
+	serve()
+	serve()
+	require.Equal(t, 2, limiter.Limit(), "never below MinLimit")
+
+	latency = 10 * time.Millisecond
+	for i := 0; i < 10; i++ {
+		serve()
+	}
+	require.Greater(t, limiter.Limit(), 2, "fast requests increase the limit")
+
+	// fill the limit with blocked requests and check the next is shed
+	block := make(chan struct{})
+	blocking := limiter.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	limit := limiter.Limit()
+	done := sync.WaitGroup{}
+	for i := 0; i < limit; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			blocking.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		}()
+	}
+	require.Eventually(t, func() bool {
+		limiter.mu.Lock()
+		defer limiter.mu.Unlock()
+		return limiter.inFlight == limit
+	}, time.Second, time.Millisecond)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	close(block)
+	done.Wait()
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/CodeNamor/Common/errors"
+	"github.com/CodeNamor/Common/logging"
+	"github.com/CodeNamor/Common/logging/logfields"
+	"github.com/gorilla/mux"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// panicCount is the number of panics recovered by all recovery middleware
+var panicCount uint64
+
+// PanicCount returns the number of panics recovered by the recovery
+// middleware since the process started
+func PanicCount() uint64 {
+	return atomic.LoadUint64(&panicCount)
+}
+
+type recoveryOptions struct {
+	repanic bool
+	onPanic func(recovered interface{}, r *http.Request)
+}
+
+// A RecoveryOption sets options for NewRecoveryMiddleware
+type RecoveryOption func(*recoveryOptions)
+
+// WithRepanic is a RecoveryOption to panic again after the panic has
+// been logged and counted, so it is impossible to miss in development.
+// It should not be enabled in production.
+func WithRepanic(repanic bool) RecoveryOption {
+	return func(o *recoveryOptions) {
+		o.repanic = repanic
+	}
+}
+
+// WithOnPanic is a RecoveryOption to call fn for each recovered panic,
+// such as to increment a metric
+func WithOnPanic(fn func(recovered interface{}, r *http.Request)) RecoveryOption {
+	return func(o *recoveryOptions) {
+		o.onPanic = fn
+	}
+}
+
+// RecoveryMiddleware is the recovery middleware with the default options,
+// see NewRecoveryMiddleware
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return NewRecoveryMiddleware()(next)
+}
+
+// NewRecoveryMiddleware creates middleware which recovers from panics in
+// later handlers. The panic is logged at the Error level with the stack
+// and request ID, counted, and if nothing has been written yet a 500
+// Internal Server Error is returned with an errors.ErrorLog JSON body.
+// http.ErrAbortHandler panics are passed through to net/http.
+func NewRecoveryMiddleware(opt ...RecoveryOption) mux.MiddlewareFunc {
+	opts := recoveryOptions{}
+	for _, o := range opt {
+		o(&opts)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := newResponseRecorder(w)
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					panic(recovered) // deliberate abort, let net/http handle it
+				}
+
+				atomic.AddUint64(&panicCount, 1)
+				logging.WithRequestID(r.Context()).WithFields(logrus.Fields{
+					logfields.Panic:   fmt.Sprintf("%v", recovered),
+					logfields.Stack:   string(debug.Stack()),
+					logfields.Request: r.Method,
+					logfields.URI:     r.URL.RequestURI(),
+				}).Error("panic recovered")
+				if opts.onPanic != nil {
+					opts.onPanic(recovered, r)
+				}
+				if opts.repanic {
+					panic(recovered)
+				}
+
+				if !recorder.wroteHeader {
+					WriteError(recorder, r, &errors.ErrorLog{
+						RootCause:     "internal server error",
+						StatusCode:    "500",
+						ExceptionType: "panic",
+						Err:           pkgerrors.New(http.StatusText(http.StatusInternalServerError)),
+					}, WithoutLogging()) // already logged with the stack
+				}
+			}()
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
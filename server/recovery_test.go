@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RecoveryMiddleware(t *testing.T) {
+	logs := captureLogs(t)
+	handler := RequestIDMiddleware(DefaultRequestIDHeader)(RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+	before := PanicCount()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/widgets", nil)
+	req.Header.Set(DefaultRequestIDHeader, "rid-1")
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	body := decodeErrorBody(t, w.Body.Bytes())
+	require.Equal(t, "500", body["StatusCode"])
+	require.Equal(t, "internal server error", body["RootCause"])
+	require.Equal(t, "panic", body["ExceptionType"])
+	require.NotContains(t, w.Body.String(), "boom", "panic details are not returned to the client")
+
+	require.Equal(t, before+1, PanicCount())
+	require.Contains(t, logs.String(), "panic recovered")
+	require.Contains(t, logs.String(), "panic=boom")
+	require.Contains(t, logs.String(), "requestId=rid-1")
+	require.Contains(t, logs.String(), "recovery_test.go", "stack is logged")
+}
+
+func Test_RecoveryMiddleware_AfterWrite(t *testing.T) {
+	captureLogs(t)
+	handler := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("late")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.Empty(t, w.Body.String())
+}
+
+func Test_NewRecoveryMiddleware_Options(t *testing.T) {
+	captureLogs(t)
+	var onPanicValue interface{}
+	handler := NewRecoveryMiddleware(
+		WithRepanic(true),
+		WithOnPanic(func(recovered interface{}, r *http.Request) { onPanicValue = recovered }),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("dev")
+	}))
+
+	require.PanicsWithValue(t, "dev", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	require.Equal(t, "dev", onPanicValue)
+
+	abort := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	before := PanicCount()
+	require.Panics(t, func() {
+		abort.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	require.Equal(t, before, PanicCount(), "aborts are not counted")
+}
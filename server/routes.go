@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// Walker is a router which can be walked, such as a mux.Router or a Router
+type Walker interface {
+	Walk(walkFn mux.WalkFunc) error
+}
+
+// Walk walks the health endpoints and the service routes
+func (r *Router) Walk(walkFn mux.WalkFunc) error {
+	return r.root.Walk(walkFn)
+}
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	Name         string   `json:"name,omitempty"`
+	PathTemplate string   `json:"pathTemplate"`
+	Methods      []string `json:"methods,omitempty"` // empty matches any method
+	Queries      []string `json:"queries,omitempty"`
+}
+
+// Routes lists the routes of router which have a handler, sorted by
+// path template
+func Routes(router Walker) ([]RouteInfo, error) {
+	routes := []RouteInfo{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			return nil // subrouter
+		}
+		pathTemplate, err := route.GetPathTemplate()
+		if err != nil {
+			return nil // matches on something other than the path
+		}
+		methods, _ := route.GetMethods()
+		queries, _ := route.GetQueriesTemplates()
+		if len(queries) == 0 {
+			queries = nil
+		}
+		routes = append(routes, RouteInfo{
+			Name:         route.GetName(),
+			PathTemplate: pathTemplate,
+			Methods:      methods,
+			Queries:      queries,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routes[i].PathTemplate < routes[j].PathTemplate
+	})
+	return routes, nil
+}
+
+// RoutesHandler serves the JSON route inventory of router, such as on
+// the admin listener with WithAdminHandler("/debug/routes", ...)
+func RoutesHandler(router Walker) http.HandlerFunc {
+	return DefaultHandler(func(w http.ResponseWriter, _ *http.Request) {
+		routes, err := Routes(router)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(routes)
+	})
+}
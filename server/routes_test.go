@@ -0,0 +1,36 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Routes(t *testing.T) {
+	router := NewRouter()
+	noop := func(http.ResponseWriter, *http.Request) {}
+	router.HandleFunc("/widgets", noop).Methods(http.MethodGet, http.MethodPost).Name("widgets")
+	router.HandleFunc("/widgets/{id:[0-9]+}", noop).Methods(http.MethodGet).Name("getWidget")
+	router.HandleFunc("/search", noop).Queries("q", "{q}")
+
+	routes, err := Routes(router)
+	require.NoError(t, err)
+	require.Equal(t, []RouteInfo{
+		{PathTemplate: DefaultLiveURLPath},
+		{PathTemplate: DefaultReadyURLPath},
+		{PathTemplate: "/search", Queries: []string{"q={q}"}},
+		{Name: "widgets", PathTemplate: "/widgets", Methods: []string{http.MethodGet, http.MethodPost}},
+		{Name: "getWidget", PathTemplate: "/widgets/{id:[0-9]+}", Methods: []string{http.MethodGet}},
+	}, routes)
+
+	admin := NewAdminHandler(WithAdminHandler("/debug/routes", RoutesHandler(router)))
+	w := httptest.NewRecorder()
+	admin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/routes", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	served := []RouteInfo{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &served))
+	require.Equal(t, routes, served)
+}
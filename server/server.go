@@ -2,11 +2,11 @@ package server
 
 import (
 	"context"
-
+	stderrors "errors"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"sync/atomic"
 	"syscall"
 
@@ -18,55 +18,173 @@ import (
 // to listen for SIGINT and SIGTERM to perform graceful shutdown,
 // and launches the server. If the server returns anything other
 // than a normal close, then it is returned, otherwise returns nil.ListenAndServe
-// It logs at the Info level
+// It logs at the Info level. The server has no timeouts and the
+// graceful shutdown has no deadline, as http.Server defaults to, see
+// ListenAndServeWithOptions for safer defaults.
 func ListenAndServe(addr string, handler http.Handler) error {
+	return ListenAndServeWithOptions(addr, handler, withoutLimits())
+}
+
+// ListenAndServeWithOptions is ListenAndServe with Options to set the
+// http.Server timeouts and limits, any not set use the Default values,
+// and to control the graceful shutdown sequence (readiness, pre-stop
+// delay, shutdown deadline and shutdown hooks).
+func ListenAndServeWithOptions(addr string, handler http.Handler, opt ...Option) error {
 	logging.Info("HTTP Server address " + addr)
-	srv := &http.Server{
-		Addr:    addr,
-		Handler: handler,
-	}
+	srv := newHTTPServer(addr, handler, newOptions(opt...))
+
+	ctx, cancel := SignalContext(context.Background())
+	defer cancel()
+	return Run(ctx, srv, opt...)
+}
+
+// SignalContext returns a copy of parent which is cancelled when
+// SIGINT or SIGTERM is received, for use with Run. Calling cancel
+// stops listening for the signals.
+func SignalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
 
 	// setup signals channel for Ctrl+C and SIGTERM
 	signals := make(chan os.Signal, 1)                    // channel to listen to signals
 	signal.Notify(signals, os.Interrupt, syscall.SIGTERM) // forward ctrl-c + SIGTERM to signals chan
 
-	wgServer := sync.WaitGroup{}
-	wgServer.Add(2) // wait for signal and listen routines
+	go func() { // routine to wait for any shutdown signal
+		defer signal.Stop(signals)
+		select {
+		case killSignal := <-signals:
+			switch killSignal {
+			case os.Interrupt:
+				logging.Info("SIGINT received (Control-C ?)")
+			case syscall.SIGTERM:
+				logging.Info("SIGTERM received (Kubernetes shutdown?)")
+			}
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	var serverError error
+	return ctx, cancel
+}
 
-	go func() { // routine to wait for any shutdown signal
-		defer wgServer.Done()
-		killSignal := <-signals // wait for a signal
-		switch killSignal {
-		case os.Interrupt:
-			logging.Info("SIGINT received (Control-C ?)")
-		case syscall.SIGTERM:
-			logging.Info("SIGTERM received (Kubernetes shutdown?)")
-		case nil: // if we sent a nil signal in, then exit now
-			return // exit now, probably due to server error
+// Run listens on srv.Addr and serves until ctx is cancelled, then
+// performs the graceful shutdown and returns once it has finished.
+// If a listener fails, its ListenerError is returned, otherwise
+// returns nil. Only the shutdown, TLS and listener Options apply, the
+// timeouts and limits of srv are used as they are.
+func Run(ctx context.Context, srv *http.Server, opt ...Option) error {
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := listen(ListenerConfig{Addr: addr})
+	if err != nil {
+		runShutdownHooks(newOptions(opt...)) // still release resources
+		return err
+	}
+	return Serve(ctx, srv, ln, opt...)
+}
+
+// Serve is Run using the provided listener, such as one on an
+// ephemeral port in tests. The listeners are closed on return. If TLS
+// Options are given srv.TLSConfig is replaced and TLS is served on ln,
+// reloading the certificate files while serving. Any WithListener
+// listeners and the WithAdminListener server are started first and
+// shut down with srv.
+func Serve(ctx context.Context, srv *http.Server, ln net.Listener, opt ...Option) error {
+	opts := newOptions(opt...)
+	handler := srv.Handler // additional listeners use the handler before h2c is applied to srv
+
+	serve := srv.Serve
+	if opts.tls != nil {
+		reloader, err := newCertReloader(opts.tls)
+		if err != nil {
+			ln.Close()
+			runShutdownHooks(opts) // still release resources
+			return err
+		}
+		srv.TLSConfig = reloader.tlsConfig()
+		watchCtx, stopWatching := context.WithCancel(ctx)
+		defer stopWatching()
+		go reloader.watch(watchCtx)
+		serve = func(ln net.Listener) error {
+			return srv.ServeTLS(ln, "", "")
 		}
+	} else if opts.h2c {
+		enableH2C(srv)
+	}
 
-		logging.Info("graceful shutdown initiated...")
-		srv.Shutdown(context.Background())
-		logging.Info("graceful shutdown complete")
-	}()
+	listeners := []servedListener{{srv: srv, ln: ln, serve: serve}}
+	for _, config := range opts.listeners {
+		listenerLn, err := listen(config)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.ln.Close()
+			}
+			runShutdownHooks(opts) // still release resources
+			return err
+		}
+		listenerSrv := newListenerServer(srv, handler, config)
+		listeners = append(listeners, servedListener{srv: listenerSrv, ln: listenerLn, serve: listenerSrv.Serve})
+		logging.Info("HTTP Server listening on " + listenerLn.Addr().Network() + " " + listenerLn.Addr().String())
+	}
 
-	go func() { // routine to begin listening and serving
-		defer wgServer.Done()
-		serverError = srv.ListenAndServe()
-		if !isNormalShutdown(serverError) {
-			signals <- nil // we need to exit now, tell other routine
+	servers := []*http.Server{}
+	for _, served := range listeners {
+		servers = append(servers, served.srv)
+	}
+	if opts.adminAddr != "" {
+		adminSrv, err := startAdminServer(opts)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.ln.Close()
+			}
+			runShutdownHooks(opts) // still release resources
+			return err
 		}
-	}()
+		defer adminSrv.Close()
+		servers = append(servers, adminSrv)
+	}
+
+	serverErrors := make(chan error, len(listeners))
+	for _, served := range listeners {
+		go func(served servedListener) { // routine to begin serving
+			serverErrors <- served.err(served.serve(served.ln))
+		}(served)
+	}
+
+	errs := []error{}
+	select {
+	case serverError := <-serverErrors: // exit now, probably due to server error
+		if serverError != nil {
+			logging.Error("shutting down after listener failed: ", serverError)
+			errs = append(errs, serverError)
+		}
+		drainServers(opts, servers...) // stop the other listeners
+		runShutdownHooks(opts)         // still release resources
+	case <-ctx.Done():
+		gracefulShutdown(opts, servers...)
+		errs = append(errs, <-serverErrors)
+	}
 
-	// wait for rountines to finish
-	wgServer.Wait()
-	if isNormalShutdown(serverError) {
-		return nil
+	for i := 1; i < len(listeners); i++ {
+		errs = append(errs, <-serverErrors)
 	}
+	return joinListenerErrors(errs)
+}
 
-	return serverError
+// joinListenerErrors returns nil, the only ListenerError, or all of
+// them joined
+func joinListenerErrors(errs []error) error {
+	failed := []error{}
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == 1 {
+		return failed[0]
+	}
+	return stderrors.Join(failed...)
 }
 
 // CreateAndHandleReadinessLiveness creates atomic handlers for
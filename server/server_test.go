@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startServe runs Serve on an ephemeral port returning the base url
+// and a channel which receives the result of Serve
+func startServe(t *testing.T, ctx context.Context, handler http.Handler, opt ...Option) (string, chan error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	result := make(chan error, 1)
+	go func() {
+		result <- Serve(ctx, &http.Server{Handler: handler}, ln, opt...)
+	}()
+	return "http://" + ln.Addr().String(), result
+}
+
+func getBody(t *testing.T, url string) string {
+	res, err := http.Get(url)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func Test_Serve_StopsWhenContextCancelled(t *testing.T) {
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	hooksRun := make(chan string, 2)
+	hook := func(name string) Option {
+		return WithShutdownHook(name, func(context.Context) error {
+			hooksRun <- name
+			return nil
+		})
+	}
+	url1, result1 := startServe(t, ctx1, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("one"))
+	}), hook("one"))
+	url2, result2 := startServe(t, ctx2, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("two"))
+	}), hook("two"))
+
+	// two servers in one process
+	require.Equal(t, "one", getBody(t, url1))
+	require.Equal(t, "two", getBody(t, url2))
+
+	cancel1()
+	select {
+	case err := <-result1:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after cancel")
+	}
+	require.Equal(t, "one", <-hooksRun)
+	_, err := http.Get(url1)
+	require.Error(t, err)
+
+	// second server unaffected
+	require.Equal(t, "two", getBody(t, url2))
+	cancel2()
+	require.NoError(t, <-result2)
+}
+
+func Test_Serve_ReturnsServerError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln.Close()
+
+	hookRun := false
+	err = Serve(context.Background(), &http.Server{}, ln, WithShutdownHook("hook", func(context.Context) error {
+		hookRun = true
+		return nil
+	}))
+	require.Error(t, err)
+	require.True(t, hookRun)
+}
+
+func Test_Run_ListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	// address already in use
+	err = Run(context.Background(), &http.Server{Addr: ln.Addr().String()})
+	require.Error(t, err)
+}
+
+func Test_Run_AlreadyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ready := true
+	err := Run(ctx, &http.Server{Addr: "127.0.0.1:0"}, WithReadinessFn(func(value bool) { ready = value }))
+	require.NoError(t, err)
+	require.False(t, ready)
+}
+
+func Test_SignalContext_Cancel(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := SignalContext(parent)
+	defer cancel()
+	require.NoError(t, ctx.Err())
+	cancelParent()
+	<-ctx.Done()
+	require.Equal(t, context.Canceled, ctx.Err())
+}
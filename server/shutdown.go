@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/CodeNamor/Common/logging"
+)
+
+// gracefulShutdown sets readiness to false, waits the pre-stop delay
+// so load balancers stop sending traffic, drains the servers within the
+// shutdown timeout closing any connections still open after it, and
+// then runs the shutdown hooks in reverse order.
+func gracefulShutdown(opts *options, servers ...*http.Server) {
+	logging.Info("graceful shutdown initiated...")
+	if opts.readinessFn != nil {
+		opts.readinessFn(false)
+		logging.Info("readiness set to false")
+	}
+	if opts.preStopDelay > 0 {
+		logging.Info("waiting ", opts.preStopDelay, " before draining connections")
+		time.Sleep(opts.preStopDelay)
+	}
+
+	drainServers(opts, servers...)
+	runShutdownHooks(opts)
+	logging.Info("graceful shutdown complete")
+}
+
+// drainServers shuts the servers down concurrently within the shutdown
+// timeout, closing any connections still open after it
+func drainServers(opts *options, servers ...*http.Server) {
+	drainCtx, cancelDrain := shutdownContext(opts)
+	defer cancelDrain()
+	wg := sync.WaitGroup{}
+	for _, srv := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(drainCtx); err != nil {
+				logging.Warning("graceful shutdown did not complete within ", opts.shutdownTimeout, ", closing connections: ", err)
+				srv.Close()
+			}
+		}(srv)
+	}
+	wg.Wait()
+}
+
+// runShutdownHooks runs the hooks in reverse order of registration
+// sharing one deadline, errors are logged and do not stop later hooks
+func runShutdownHooks(opts *options) {
+	if len(opts.shutdownHooks) == 0 {
+		return
+	}
+	ctx, cancel := shutdownContext(opts)
+	defer cancel()
+	for i := len(opts.shutdownHooks) - 1; i >= 0; i-- {
+		namedHook := opts.shutdownHooks[i]
+		logging.Info("running shutdown hook ", namedHook.name)
+		if err := namedHook.hook(ctx); err != nil {
+			logging.Error("shutdown hook ", namedHook.name, " failed: ", err)
+		}
+	}
+}
+
+// shutdownContext returns a context which expires after the shutdown
+// timeout, or never if it is zero
+func shutdownContext(opts *options) (context.Context, context.CancelFunc) {
+	if opts.shutdownTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), opts.shutdownTimeout)
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_gracefulShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	handlerStarted := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(handlerStarted)
+		<-release // stuck request which never finishes on its own
+	})}
+	go srv.Serve(ln)
+	go http.Get("http://" + ln.Addr().String())
+	<-handlerStarted
+
+	ready := true
+	calls := []string{}
+	opts := newOptions(
+		WithReadinessFn(func(value bool) {
+			ready = value
+			calls = append(calls, "readiness")
+		}),
+		WithPreStopDelay(10*time.Millisecond),
+		WithShutdownTimeout(50*time.Millisecond),
+		WithShutdownHook("db", func(ctx context.Context) error {
+			calls = append(calls, "db")
+			return nil
+		}),
+		WithShutdownHook("logs", func(ctx context.Context) error {
+			_, hasDeadline := ctx.Deadline()
+			require.True(t, hasDeadline)
+			calls = append(calls, "logs")
+			return context.Canceled // errors are logged and later hooks still run
+		}),
+	)
+
+	start := time.Now()
+	gracefulShutdown(opts, srv)
+	elapsed := time.Since(start)
+
+	require.False(t, ready)
+	require.Equal(t, []string{"readiness", "logs", "db"}, calls)
+	require.GreaterOrEqual(t, elapsed, 60*time.Millisecond, "should wait pre-stop delay and shutdown timeout")
+	require.Less(t, elapsed, 5*time.Second, "stuck connection must not block shutdown")
+	_, err = http.Get("http://" + ln.Addr().String())
+	require.Error(t, err, "server should be closed")
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/CodeNamor/Common/logging"
+	"github.com/pkg/errors"
+)
+
+// DefaultCertReloadInterval is how often the certificate files are
+// checked for changes unless set with WithCertReloadInterval
+const DefaultCertReloadInterval = 30 * time.Second
+
+type tlsOptions struct {
+	certFile       string
+	keyFile        string
+	clientCAFile   string
+	minVersion     uint16
+	cipherSuites   []uint16
+	reloadInterval time.Duration
+}
+
+// WithTLSCertFiles is an Option to serve TLS using the PEM encoded
+// certificate and key files. The files are reloaded when they change
+// on disk, such as when a mounted Kubernetes secret is rotated.
+func WithTLSCertFiles(certFile, keyFile string) Option {
+	return func(o *options) {
+		o.tlsOpts().certFile = certFile
+		o.tlsOpts().keyFile = keyFile
+	}
+}
+
+// WithClientCAFile is an Option to require and verify client
+// certificates (mutual TLS) against the PEM encoded CA certificates
+// in caFile, which is reloaded when it changes. It requires WithTLSCertFiles.
+func WithClientCAFile(caFile string) Option {
+	return func(o *options) {
+		o.tlsOpts().clientCAFile = caFile
+	}
+}
+
+// WithMinTLSVersion is an Option to set the minimum TLS version such
+// as tls.VersionTLS13, defaults to tls.VersionTLS12
+func WithMinTLSVersion(version uint16) Option {
+	return func(o *options) {
+		o.tlsOpts().minVersion = version
+	}
+}
+
+// WithCipherSuites is an Option to restrict the TLS 1.2 cipher suites,
+// by default the Go defaults are used. TLS 1.3 suites are not configurable.
+func WithCipherSuites(cipherSuites ...uint16) Option {
+	return func(o *options) {
+		o.tlsOpts().cipherSuites = cipherSuites
+	}
+}
+
+// WithCertReloadInterval is an Option to set how often the certificate
+// and CA files are checked for changes, defaults to DefaultCertReloadInterval
+func WithCertReloadInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.tlsOpts().reloadInterval = interval
+	}
+}
+
+// tlsOpts returns the tls options creating them with defaults if needed
+func (o *options) tlsOpts() *tlsOptions {
+	if o.tls == nil {
+		o.tls = &tlsOptions{
+			minVersion:     tls.VersionTLS12,
+			reloadInterval: DefaultCertReloadInterval,
+		}
+	}
+	return o.tls
+}
+
+// certReloader holds the current certificate and client CA pool,
+// reloading them when the files' modification times change
+type certReloader struct {
+	opts *tlsOptions
+
+	mu           sync.RWMutex
+	cert         *tls.Certificate
+	clientCAs    *x509.CertPool
+	certModTimes [2]time.Time
+	caModTime    time.Time
+}
+
+// newCertReloader loads the initial certificate and CA files, failing
+// if they cannot be loaded
+func newCertReloader(opts *tlsOptions) (*certReloader, error) {
+	if opts.certFile == "" || opts.keyFile == "" {
+		return nil, errors.New("TLS requires a certificate and key file")
+	}
+	r := &certReloader{opts: opts}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// tlsConfig creates the tls.Config which always uses the current
+// certificate and client CAs
+func (r *certReloader) tlsConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion:   r.opts.minVersion,
+		CipherSuites: r.opts.cipherSuites,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.cert, nil
+		},
+	}
+	if r.opts.clientCAFile != "" {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			clientConfig := config.Clone()
+			clientConfig.GetConfigForClient = nil
+			r.mu.RLock()
+			clientConfig.ClientCAs = r.clientCAs
+			r.mu.RUnlock()
+			return clientConfig, nil
+		}
+	}
+	return config
+}
+
+// reload loads any files which have changed since they were last
+// loaded, reporting whether anything was reloaded
+func (r *certReloader) reload() (bool, error) {
+	certInfo, err := os.Stat(r.opts.certFile)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to stat TLS certificate file")
+	}
+	keyInfo, err := os.Stat(r.opts.keyFile)
+	if err != nil {
+		return false, errors.Wrap(err, "unable to stat TLS key file")
+	}
+	certModTimes := [2]time.Time{certInfo.ModTime(), keyInfo.ModTime()}
+
+	r.mu.RLock()
+	certChanged := certModTimes != r.certModTimes
+	r.mu.RUnlock()
+
+	var cert *tls.Certificate
+	if certChanged {
+		loaded, err := tls.LoadX509KeyPair(r.opts.certFile, r.opts.keyFile)
+		if err != nil {
+			return false, errors.Wrap(err, "unable to load TLS certificate")
+		}
+		cert = &loaded
+	}
+
+	var clientCAs *x509.CertPool
+	var caModTime time.Time
+	if r.opts.clientCAFile != "" {
+		caInfo, err := os.Stat(r.opts.clientCAFile)
+		if err != nil {
+			return false, errors.Wrap(err, "unable to stat client CA file")
+		}
+		caModTime = caInfo.ModTime()
+		r.mu.RLock()
+		caChanged := caModTime != r.caModTime
+		r.mu.RUnlock()
+		if caChanged {
+			pem, err := os.ReadFile(r.opts.clientCAFile)
+			if err != nil {
+				return false, errors.Wrap(err, "unable to read client CA file")
+			}
+			clientCAs = x509.NewCertPool()
+			if !clientCAs.AppendCertsFromPEM(pem) {
+				return false, errors.Errorf("no certificates found in client CA file %s", r.opts.clientCAFile)
+			}
+		}
+	}
+
+	if cert == nil && clientCAs == nil {
+		return false, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cert != nil {
+		r.cert = cert
+		r.certModTimes = certModTimes
+	}
+	if clientCAs != nil {
+		r.clientCAs = clientCAs
+		r.caModTime = caModTime
+	}
+	return true, nil
+}
+
+// watch reloads changed files every interval until ctx is done. If a
+// reload fails the previous certificate continues to be used.
+func (r *certReloader) watch(ctx context.Context) {
+	if r.opts.reloadInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(r.opts.reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				logging.Warning("TLS certificate reload failed, continuing with previous certificate: ", err)
+			} else if reloaded {
+				logging.Info("TLS certificate reloaded")
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a locally generated certificate and key
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert generates a certificate signed by parent, or self signed
+// CA if parent is nil
+func newTestCert(t *testing.T, commonName string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signerCert, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// writeCertFiles writes the cert and key setting the modification time
+// to modTime so reloads are detected regardless of file system precision
+func writeCertFiles(t *testing.T, c *testCert, certFile, keyFile string, modTime time.Time) {
+	require.NoError(t, os.WriteFile(certFile, c.certPEM, 0600))
+	require.NoError(t, os.WriteFile(keyFile, c.keyPEM, 0600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func tlsClient(ca *testCert, clientCert *testCert) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	config := &tls.Config{RootCAs: roots}
+	if clientCert != nil {
+		config.Certificates = []tls.Certificate{{
+			Certificate: [][]byte{clientCert.cert.Raw},
+			PrivateKey:  clientCert.key,
+		}}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+}
+
+// peerCommonName makes a request returning the server certificate common name
+func peerCommonName(client *http.Client, url string) (string, error) {
+	res, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	return res.TLS.PeerCertificates[0].Subject.CommonName, nil
+}
+
+func Test_Serve_TLSWithReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	ca := newTestCert(t, "test-ca", nil, 0)
+	writeCertFiles(t, newTestCert(t, "server-1", ca, x509.ExtKeyUsageServerAuth), certFile, keyFile, time.Now().Add(-time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	url, result := startServe(t, ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithTLSCertFiles(certFile, keyFile),
+		WithMinTLSVersion(tls.VersionTLS12),
+		WithCertReloadInterval(10*time.Millisecond),
+	)
+	url = "https" + url[len("http"):]
+	client := tlsClient(ca, nil)
+
+	commonName, err := peerCommonName(client, url)
+	require.NoError(t, err)
+	require.Equal(t, "server-1", commonName)
+
+	// rotate the certificate on disk
+	writeCertFiles(t, newTestCert(t, "server-2", ca, x509.ExtKeyUsageServerAuth), certFile, keyFile, time.Now())
+	require.Eventually(t, func() bool {
+		commonName, err := peerCommonName(client, url)
+		return err == nil && commonName == "server-2"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// a broken rotation keeps the previous certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0600))
+	time.Sleep(50 * time.Millisecond)
+	commonName, err = peerCommonName(client, url)
+	require.NoError(t, err)
+	require.Equal(t, "server-2", commonName)
+
+	cancel()
+	require.NoError(t, <-result)
+}
+
+func Test_Serve_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	ca := newTestCert(t, "test-ca", nil, 0)
+	otherCA := newTestCert(t, "other-ca", nil, 0)
+	writeCertFiles(t, newTestCert(t, "server", ca, x509.ExtKeyUsageServerAuth), certFile, keyFile, time.Now())
+	require.NoError(t, os.WriteFile(caFile, ca.certPEM, 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	url, _ := startServe(t, ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}), WithTLSCertFiles(certFile, keyFile), WithClientCAFile(caFile))
+	url = "https" + url[len("http"):]
+
+	res, err := tlsClient(ca, newTestCert(t, "client", ca, x509.ExtKeyUsageClientAuth)).Get(url)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	_, err = tlsClient(ca, nil).Get(url)
+	require.Error(t, err, "client certificate is required")
+
+	_, err = tlsClient(ca, newTestCert(t, "intruder", otherCA, x509.ExtKeyUsageClientAuth)).Get(url)
+	require.Error(t, err, "client certificate from another CA is rejected")
+}
+
+func Test_Serve_TLSMissingFiles(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	err = Serve(context.Background(), &http.Server{}, ln, WithTLSCertFiles("missing.crt", "missing.key"))
+	require.Error(t, err)
+}
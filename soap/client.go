@@ -2,6 +2,7 @@ package soap
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"io/ioutil" //TODO: migrate to package io
 	"net/http"
@@ -152,6 +153,7 @@ type basicAuth struct {
 type options struct {
 	auth        *basicAuth
 	httpHeaders map[string]string
+	propagation []requestclient.PropagationOption
 }
 
 var defaultOptions = options{}
@@ -173,6 +175,16 @@ func WithHTTPHeaders(headers map[string]string) Option {
 	}
 }
 
+// WithRequestPropagation is an Option to forward the request ID and
+// W3C trace context headers from the context passed to CallContext,
+// see requestclient.NewPropagatingClient for the available options
+func WithRequestPropagation(propagationOpts ...requestclient.PropagationOption) Option {
+	return func(o *options) {
+		// non-nil even when no options are given, which enables propagation
+		o.propagation = append([]requestclient.PropagationOption{}, propagationOpts...)
+	}
+}
+
 // Client is soap client
 type Client struct {
 	httpClient requestclient.RequestClient
@@ -189,6 +201,9 @@ func NewClient(httpClient requestclient.RequestClient, url string, logEntry *log
 	for _, o := range opt {
 		o(&opts)
 	}
+	if opts.propagation != nil {
+		httpClient = requestclient.NewPropagatingClient(httpClient, opts.propagation...)
+	}
 	return &Client{
 		httpClient: httpClient,
 		url:        url,
@@ -204,6 +219,11 @@ func (s *Client) AddHeader(header interface{}) {
 
 // Call performs HTTP POST request
 func (s *Client) Call(soapAction string, request, response interface{}) error {
+	return s.CallContext(context.Background(), soapAction, request, response)
+}
+
+// CallContext performs HTTP POST request using ctx for the request
+func (s *Client) CallContext(ctx context.Context, soapAction string, request, response interface{}) error {
 	var envelope Envelope
 	soapRequest, ok := request.(Request)
 	if ok {
@@ -241,7 +261,7 @@ func (s *Client) Call(soapAction string, request, response interface{}) error {
 	// we log.info request (and response if available) on errors already
 	// fmt.Println("buffer", requestBodyBuffer.String()) // raw soap request
 
-	req, err := http.NewRequest("POST", s.url, requestBodyBuffer)
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, requestBodyBuffer)
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package soap
 
 import (
+	"context"
 	"encoding/xml"
 	"net/http"
 	"net/http/httptest"
@@ -8,6 +9,8 @@ import (
 
 	"github.com/CodeNamor/Common/logging"
 	"github.com/CodeNamor/Common/logging/logfields"
+	"github.com/CodeNamor/Common/requestclient"
+	"github.com/ascarter/requestid"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -123,3 +126,22 @@ func TestClient_Send_Correct_Headers(t *testing.T) {
 		}
 	}
 }
+
+func TestClient_CallContext_Propagates_RequestID(t *testing.T) {
+	var gotHeaders http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header
+	}))
+	defer ts.Close()
+
+	logEntry := logging.WithField(logfields.RequestId, "")
+	client := NewClient(MockRequestClient{client: &http.Client{}}, ts.URL, logEntry,
+		WithRequestPropagation(requestclient.WithRequestIDHeader("X-Correlation-ID")))
+	ctx := requestid.NewContext(context.Background(), "rid-123")
+
+	err := client.CallContext(ctx, "GetData", &Ping{}, &PingResponse{})
+	assert.NoError(t, err)
+	assert.Equal(t, "rid-123", gotHeaders.Get("X-Correlation-ID"))
+	_, err = requestclient.ParseTraceParent(gotHeaders.Get(requestclient.TraceParentHeader))
+	assert.NoError(t, err)
+}